@@ -0,0 +1,183 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy tells what happens to an entry when a queue is full
+type OverflowPolicy byte
+
+const (
+	// OverflowDropNewest drops the entry being queued. This is the default.
+	OverflowDropNewest OverflowPolicy = iota
+
+	// OverflowBlock waits until the queue has room, blocking the logging call
+	OverflowBlock
+
+	// OverflowDropOldest drops the entry queued first to make room
+	OverflowDropOldest
+)
+
+// AsyncHookOptions configures NewAsyncHook. The zero value is ready to use.
+type AsyncHookOptions struct {
+	// QueueSize is how many entries wait for a worker, 1024 when zero
+	QueueSize int
+
+	// Workers is how many goroutines call the hook, 1 when zero
+	Workers int
+
+	// Overflow tells what happens when the queue is full
+	Overflow OverflowPolicy
+
+	// OnError receives the errors returned by the hook, which are written to os.Stderr when nil
+	OnError func(err error)
+}
+
+// AsyncHook calls an entry hook from a bounded pool of workers, so a slow hook,
+// like one posting to a webhook, does not stall the logging calls.
+//
+// The hook receives clones of the entries, so it can neither change nor drop them.
+// Emitter.Close, and so F, flush the queue before the application halts.
+type AsyncHook struct {
+	hook     EntryHook
+	queue    chan *Entry
+	overflow OverflowPolicy
+	onError  func(err error)
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	closed  bool
+
+	dropped uint64
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewAsyncHook starts the workers calling the hook
+func NewAsyncHook(hook EntryHook, options AsyncHookOptions) *AsyncHook {
+	if options.QueueSize <= 0 {
+		options.QueueSize = 1024
+	}
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+
+	h := &AsyncHook{
+		hook:     hook,
+		queue:    make(chan *Entry, options.QueueSize),
+		overflow: options.Overflow,
+		onError:  options.OnError,
+		stop:     make(chan struct{}),
+	}
+	h.idle = sync.NewCond(&h.mu)
+
+	h.workers.Add(options.Workers)
+	for i := 0; i < options.Workers; i++ {
+		go h.work()
+	}
+	return h
+}
+
+// Fire implements EntryHook, queueing a clone of the entry
+func (h *AsyncHook) Fire(entry *Entry) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		atomic.AddUint64(&h.dropped, 1)
+		return nil
+	}
+	h.pending++
+	h.mu.Unlock()
+
+	clone := entry.Clone()
+	if h.overflow == OverflowBlock {
+		h.queue <- clone
+		return nil
+	}
+	for {
+		select {
+		case h.queue <- clone:
+			return nil
+		default:
+		}
+		if h.overflow == OverflowDropOldest {
+			select {
+			case <-h.queue:
+				atomic.AddUint64(&h.dropped, 1)
+				h.done()
+				continue
+			default:
+			}
+		}
+		atomic.AddUint64(&h.dropped, 1)
+		h.done()
+		return nil
+	}
+}
+
+// Dropped returns how many entries were dropped because the queue was full or the hook closed
+func (h *AsyncHook) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Flush waits until every queued entry is handled by the hook
+func (h *AsyncHook) Flush() error {
+	h.mu.Lock()
+	for h.pending > 0 {
+		h.idle.Wait()
+	}
+	h.mu.Unlock()
+	return nil
+}
+
+// Close flushes the queue and stops the workers. Entries fired afterwards are dropped.
+func (h *AsyncHook) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.mu.Unlock()
+
+	h.Flush()
+	close(h.stop)
+	h.workers.Wait()
+	return closeValue(h.hook)
+}
+
+func (h *AsyncHook) work() {
+	defer h.workers.Done()
+	for {
+		select {
+		case entry := <-h.queue:
+			if err := fireHook(h.hook, entry); err != nil && err != ErrDrop {
+				h.error(err)
+			}
+			h.done()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+func (h *AsyncHook) done() {
+	h.mu.Lock()
+	h.pending--
+	if h.pending == 0 {
+		h.idle.Broadcast()
+	}
+	h.mu.Unlock()
+}
+
+func (h *AsyncHook) error(err error) {
+	if h.onError != nil {
+		h.onError(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "log: async hook error: %v\n", err)
+}
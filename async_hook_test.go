@@ -0,0 +1,92 @@
+package log_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func TestAsyncHook(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []string
+
+	hook := log.NewAsyncHook(log.EntryHookFunc(func(entry *log.Entry) error {
+		<-release
+		mu.Lock()
+		got = append(got, entry.Message)
+		mu.Unlock()
+		return nil
+	}), log.AsyncHookOptions{QueueSize: 2, Workers: 1})
+
+	e := log.New(log.WithOutput(ioutil.Discard), log.WithEntryHook(hook))
+
+	// the worker may hold the first entry and the queue holds two more, the others are dropped
+	for _, msg := range []string{"one", "two", "three", "four", "five"} {
+		e.I("test", msg)
+	}
+	close(release)
+	hook.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got)+int(hook.Dropped()) != 5 || hook.Dropped() < 2 {
+		t.Errorf("invalid counts: %d handled, %d dropped", len(got), hook.Dropped())
+	}
+	if got[0] != "one" || got[1] != "two" {
+		t.Errorf("invalid handled entries: %v", got)
+	}
+}
+
+func TestAsyncHookBlock(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	var errs []error
+
+	hook := log.NewAsyncHook(log.EntryHookFunc(func(entry *log.Entry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		if count%10 == 0 {
+			return errors.New("tenth entry")
+		}
+		return nil
+	}), log.AsyncHookOptions{
+		QueueSize: 1,
+		Workers:   4,
+		Overflow:  log.OverflowBlock,
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+
+	exitCode := 0
+	e := log.New(log.WithOutput(ioutil.Discard), log.WithEntryHook(hook))
+	e.Exit = func(code int) { exitCode = code }
+
+	for i := 0; i < 99; i++ {
+		e.I("test", "hello")
+	}
+	// F closes the hook, flushing the queue before exiting
+	e.F("test", "goodbye")
+
+	if count != 100 || hook.Dropped() != 0 {
+		t.Errorf("invalid counts: %d handled, %d dropped", count, hook.Dropped())
+	}
+	if len(errs) != 10 {
+		t.Errorf("invalid errors count: %d", len(errs))
+	}
+	if exitCode != 1 {
+		t.Errorf("invalid exit code: %d", exitCode)
+	}
+
+	e.I("test", "too late")
+	if hook.Dropped() != 1 {
+		t.Errorf("entry after close was not dropped")
+	}
+}
@@ -0,0 +1,341 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned when writing to a closed output
+var ErrClosed = errors.New("log: output closed")
+
+// AsyncOutputOptions configures NewAsyncOutput. The zero value is ready to use.
+type AsyncOutputOptions struct {
+	// Size is how many entries wait to be written, 8192 when zero
+	Size int
+
+	// BatchSize is how many bytes are written at once, 64 KiB when zero.
+	// Reaching it wakes the writer before the flush interval.
+	BatchSize int
+
+	// FlushInterval is the longest time an entry waits to be written, a second when zero
+	FlushInterval time.Duration
+
+	// Overflow tells what happens when the buffer is full.
+	// Entries at the Error level and above are never dropped: older entries below
+	// the Error level are dropped to make room for them, or they wait for room.
+	Overflow OverflowPolicy
+
+	// OnError receives the errors writing to the output, which are written to os.Stderr when nil
+	OnError func(err error)
+}
+
+// AsyncOutput buffers the encoded entries and writes them in batches from a background goroutine,
+// so a slow disk or pipe does not stall the logging calls.
+//
+// The common use case is
+//
+//	out := log.NewAsyncOutput(file, log.AsyncOutputOptions{Overflow: log.OverflowDropOldest})
+//	log.Configure(log.WithOutput(out))
+//	defer log.Default.Close()
+//
+// Emitter.Sync and Emitter.Close, and so F, flush the buffer before the application halts.
+type AsyncOutput struct {
+	// first, so the counter is aligned for atomic operations on 32 bit platforms
+	dropped uint64
+
+	out       io.Writer
+	batchSize int
+	overflow  OverflowPolicy
+	onError   func(err error)
+
+	mu   sync.Mutex
+	room *sync.Cond
+
+	// ring of queued entries, keeping their buffers for reuse
+	ring  []asyncRecord
+	head  int
+	count int
+	size  int
+
+	// sequence numbers of the queued and written entries, dropped ones counting as written
+	queued  uint64
+	written uint64
+
+	err    error
+	closed bool
+
+	// outMu serializes the batches written to the output with its flushes
+	outMu sync.Mutex
+
+	batch  []byte
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type asyncRecord struct {
+	level Level
+	data  []byte
+}
+
+// NewAsyncOutput starts the goroutine writing to the output
+func NewAsyncOutput(output io.Writer, options AsyncOutputOptions) *AsyncOutput {
+	if options.Size <= 0 {
+		options.Size = 8192
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 64 << 10
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+
+	a := &AsyncOutput{
+		out:       output,
+		batchSize: options.BatchSize,
+		overflow:  options.Overflow,
+		onError:   options.OnError,
+		ring:      make([]asyncRecord, options.Size),
+		notify:    make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	a.room = sync.NewCond(&a.mu)
+
+	go a.run(options.FlushInterval)
+	return a
+}
+
+// WriteEntry implements EntryWriter, queueing the encoded entry
+func (a *AsyncOutput) WriteEntry(e *Emitter, entry *Entry) error {
+	buf := pool.Get().(*bytes.Buffer)
+	e.encoder().Encode(buf, e, entry)
+	err := a.enqueue(entry.Level, buf.Bytes())
+	buf.Reset()
+	pool.Put(buf)
+	return err
+}
+
+// Write implements io.Writer, queueing the document as an Info entry
+func (a *AsyncOutput) Write(p []byte) (int, error) {
+	if err := a.enqueue(Info, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the buffer is locked
+func (a *AsyncOutput) Concurrent() bool {
+	return true
+}
+
+// Dropped returns how many entries were dropped because the buffer was full
+func (a *AsyncOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+func (a *AsyncOutput) enqueue(level Level, p []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for a.count == len(a.ring) && !a.closed {
+		if a.overflow != OverflowBlock {
+			if level < Error && a.overflow == OverflowDropNewest {
+				atomic.AddUint64(&a.dropped, 1)
+				return nil
+			}
+			if a.dropOldest() {
+				atomic.AddUint64(&a.dropped, 1)
+				continue
+			}
+			if level < Error {
+				// only errors are queued, so the entry itself is the oldest one to drop
+				atomic.AddUint64(&a.dropped, 1)
+				return nil
+			}
+		}
+		a.wake()
+		a.room.Wait()
+	}
+	if a.closed {
+		return ErrClosed
+	}
+
+	r := &a.ring[(a.head+a.count)%len(a.ring)]
+	r.level = level
+	r.data = append(r.data[:0], p...)
+	a.count++
+	a.size += len(p)
+	a.queued++
+
+	if a.size >= a.batchSize {
+		a.wake()
+	}
+	return nil
+}
+
+// dropOldest removes the oldest entry below the Error level, telling whether there was one
+func (a *AsyncOutput) dropOldest() bool {
+	n := len(a.ring)
+	for i := 0; i < a.count; i++ {
+		if a.ring[(a.head+i)%n].level >= Error {
+			continue
+		}
+		a.size -= len(a.ring[(a.head+i)%n].data)
+
+		// move the older entries up, swapping so the buffers are kept
+		for j := i; j > 0; j-- {
+			k, prev := (a.head+j)%n, (a.head+j-1)%n
+			a.ring[k], a.ring[prev] = a.ring[prev], a.ring[k]
+		}
+		a.head = (a.head + 1) % n
+		a.count--
+		a.written++
+		return true
+	}
+	return false
+}
+
+func (a *AsyncOutput) wake() {
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (a *AsyncOutput) run(interval time.Duration) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.notify:
+		case <-ticker.C:
+		case <-a.stop:
+			a.drain()
+			return
+		}
+		a.drain()
+	}
+}
+
+// drain writes the queued entries in batches until the buffer is empty
+func (a *AsyncOutput) drain() {
+	for {
+		a.mu.Lock()
+		if a.count == 0 {
+			a.mu.Unlock()
+			return
+		}
+
+		a.batch = a.batch[:0]
+		n := 0
+		for n < a.count && (n == 0 || len(a.batch)+len(a.ring[(a.head+n)%len(a.ring)].data) <= a.batchSize) {
+			a.batch = append(a.batch, a.ring[(a.head+n)%len(a.ring)].data...)
+			n++
+		}
+		a.head = (a.head + n) % len(a.ring)
+		a.count -= n
+		a.size -= len(a.batch)
+		a.room.Broadcast()
+		a.mu.Unlock()
+
+		a.outMu.Lock()
+		_, err := a.out.Write(a.batch)
+		a.outMu.Unlock()
+		if err != nil {
+			a.error(err)
+		}
+
+		a.mu.Lock()
+		a.written += uint64(n)
+		if err != nil && a.err == nil {
+			a.err = err
+		}
+		a.room.Broadcast()
+		a.mu.Unlock()
+	}
+}
+
+// Sync waits until every entry queued before the call is written, and then flushes the output.
+// It returns the first error writing to the output since the previous call, if any.
+func (a *AsyncOutput) Sync() error {
+	a.mu.Lock()
+	target := a.queued
+	for a.written < target && !a.stopped() {
+		a.wake()
+		a.room.Wait()
+	}
+	err := a.err
+	a.err = nil
+	a.mu.Unlock()
+
+	if serr := a.syncOutput(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// Close writes the queued entries, stops the background goroutine and closes the output,
+// unless it is os.Stdout or os.Stderr. Entries written afterwards fail with ErrClosed.
+func (a *AsyncOutput) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.room.Broadcast()
+	a.mu.Unlock()
+
+	close(a.stop)
+	<-a.done
+
+	a.mu.Lock()
+	err := a.err
+	a.err = nil
+	a.mu.Unlock()
+
+	if serr := a.syncOutput(); err == nil {
+		err = serr
+	}
+	if !isStdStream(a.out) {
+		if cerr := closeValue(a.out); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// syncOutput flushes the output, which the background goroutine may be writing to
+func (a *AsyncOutput) syncOutput() error {
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	return syncValue(a.out)
+}
+
+// stopped tells whether the background goroutine returned
+func (a *AsyncOutput) stopped() bool {
+	select {
+	case <-a.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *AsyncOutput) error(err error) {
+	if a.onError != nil {
+		a.onError(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "log: async output error: %v\n", err)
+}
@@ -0,0 +1,197 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// gateWriter holds its first write until released
+type gateWriter struct {
+	syncBuffer
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+	writes  int
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.entered)
+		<-w.release
+	})
+	w.mu.Lock()
+	w.writes++
+	w.mu.Unlock()
+	return w.syncBuffer.Write(p)
+}
+
+func messages(out string) string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		msgs = append(msgs, line[strings.Index(line, `"msg":"`)+7:strings.LastIndex(line, `"`)])
+	}
+	return strings.Join(msgs, " ")
+}
+
+func TestAsyncOutputOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow log.OverflowPolicy
+		want     string
+	}{
+		{"Drop Newest", log.OverflowDropNewest, "zero b c d failure"},
+		{"Drop Oldest", log.OverflowDropOldest, "zero c d failure f"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newGateWriter()
+			out := log.NewAsyncOutput(w, log.AsyncOutputOptions{Size: 4, BatchSize: 1, Overflow: test.overflow})
+			e := log.New(log.WithOutput(out))
+
+			// the writer holds the first entry while the buffer fills up
+			e.I("test", "zero")
+			<-w.entered
+			for _, msg := range []string{"a", "b", "c", "d"} {
+				e.I("test", msg)
+			}
+			e.E("test", "failure")
+			e.I("test", "f")
+
+			close(w.release)
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := messages(w.String()); got != test.want {
+				t.Errorf("invalid entries:\nwant: %s\ngot: %s", test.want, got)
+			}
+			if out.Dropped() != 2 {
+				t.Errorf("invalid dropped count: %d", out.Dropped())
+			}
+		})
+	}
+}
+
+func TestAsyncOutputBlock(t *testing.T) {
+	w := newGateWriter()
+	close(w.release)
+	out := log.NewAsyncOutput(w, log.AsyncOutputOptions{Size: 8, Overflow: log.OverflowBlock, FlushInterval: time.Hour})
+
+	exitCode := 0
+	e := log.New(log.WithOutput(out))
+	e.Exit = func(code int) { exitCode = code }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				e.I("test", "hello")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// F closes the output, writing the buffer before exiting
+	e.F("test", "goodbye")
+
+	if got := strings.Count(w.String(), "\n"); got != 101 {
+		t.Errorf("invalid line count: %d", got)
+	}
+	if exitCode != 1 || out.Dropped() != 0 {
+		t.Errorf("invalid exit code or dropped count: %d, %d", exitCode, out.Dropped())
+	}
+	if _, err := out.Write([]byte("late\n")); err != log.ErrClosed {
+		t.Errorf("invalid error after close: %v", err)
+	}
+}
+
+func TestAsyncOutputBatches(t *testing.T) {
+	w := newGateWriter()
+	close(w.release)
+	out := log.NewAsyncOutput(w, log.AsyncOutputOptions{FlushInterval: time.Hour})
+	e := log.New(log.WithOutput(out))
+
+	for i := 0; i < 100; i++ {
+		e.I("test", "hello")
+	}
+	if got := w.String(); got != "" {
+		t.Errorf("entries were written before the flush: %s", got)
+	}
+
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(w.String(), "\n"); got != 100 {
+		t.Errorf("invalid line count: %d", got)
+	}
+	w.mu.Lock()
+	writes := w.writes
+	w.mu.Unlock()
+	if writes != 1 {
+		t.Errorf("entries were not batched: %d writes", writes)
+	}
+	out.Close()
+}
+
+func TestAsyncOutputErrors(t *testing.T) {
+	var errs []error
+	out := log.NewAsyncOutput(failingWriter{}, log.AsyncOutputOptions{
+		OnError: func(err error) { errs = append(errs, err) },
+	})
+	e := log.New(log.WithOutput(out))
+	e.I("test", "lost")
+
+	if err := e.Sync(); err == nil || err.Error() != "broken pipe" {
+		t.Errorf("invalid sync error: %v", err)
+	}
+	if len(errs) != 1 || errs[0].Error() != "broken pipe" {
+		t.Errorf("invalid errors: %v", errs)
+	}
+	out.Close()
+}
+
+func TestAsyncOutputSyncWhileWriting(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	out := log.NewAsyncOutput(w, log.AsyncOutputOptions{BatchSize: 1, Overflow: log.OverflowBlock})
+	e := log.New(log.WithOutput(out))
+
+	done := make(chan struct{})
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				e.Sync()
+			}
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		e.I("test", "hello")
+	}
+	close(done)
+	<-synced
+
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 10000 {
+		t.Errorf("invalid line count: %d", got)
+	}
+}
@@ -0,0 +1,193 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// Fields named like the header fields of the cloud encoders are prefixed with cloudFieldPrefix,
+// like fields.message, so the documents never hold the same key twice
+const cloudFieldPrefix = "fields."
+
+// GCPEncoder renders entries as JSON documents for Google Cloud Logging, one per line,
+// as collected from the standard output by Cloud Run, GKE and App Engine.
+//
+// The header is written as severity, message and time, the severity being named after the syslog
+// severity of the level, and the tag as the tag label. The TraceIDField and SpanIDField fields are
+// written as logging.googleapis.com/trace and logging.googleapis.com/spanId, linking the entries to Cloud Trace.
+// Fields named like the header ones are prefixed with fields., like fields.severity.
+type GCPEncoder struct {
+	// ProjectID qualifies the trace ids, the GOOGLE_CLOUD_PROJECT environment variable when empty,
+	// which is read once
+	ProjectID string
+}
+
+var gcpReserved = map[string]bool{
+	"severity": true, "message": true, "time": true, "logging.googleapis.com/labels": true,
+	"logging.googleapis.com/trace": true, "logging.googleapis.com/spanId": true,
+}
+
+var (
+	gcpProjectOnce sync.Once
+	gcpProject     string
+)
+
+func defaultGCPProject() string {
+	gcpProjectOnce.Do(func() {
+		gcpProject = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	})
+	return gcpProject
+}
+
+// gcpSeverities are the Cloud Logging severities, by syslog severity
+var gcpSeverities = [...]string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+
+// Encode implements Encoder
+func (g GCPEncoder) Encode(buf *bytes.Buffer, e *Emitter, entry *Entry) {
+	buf.WriteString(`{"severity":"`)
+	buf.WriteString(gcpSeverities[entry.Level.Severity()])
+	buf.WriteString(`","message":`)
+	writeJSONString(buf, entry.Message)
+	buf.WriteString(`,"time":"`)
+	buf.WriteString(entry.Time.UTC().Format(time.RFC3339Nano))
+	buf.WriteByte('"')
+	if entry.Tag != "" {
+		buf.WriteString(`,"logging.googleapis.com/labels":{"tag":`)
+		writeJSONString(buf, entry.Tag)
+		buf.WriteByte('}')
+	}
+
+	traceID, spanID := writeCloudFields(buf, e, entry, gcpReserved)
+	if traceID != "" {
+		project := g.ProjectID
+		if project == "" {
+			project = defaultGCPProject()
+		}
+		buf.WriteString(`,"logging.googleapis.com/trace":`)
+		if project != "" {
+			traceID = "projects/" + project + "/traces/" + traceID
+		}
+		writeJSONString(buf, traceID)
+	}
+	if spanID != "" {
+		buf.WriteString(`,"logging.googleapis.com/spanId":"`)
+		buf.WriteString(spanID)
+		buf.WriteByte('"')
+	}
+	buf.WriteString("}\n")
+}
+
+// AWSEncoder renders entries as JSON documents for CloudWatch Logs, one per line, following
+// the JSON log format of Lambda.
+//
+// The header is written as timestamp, level, message and logger, the level in upper case.
+// The TraceIDField field is written as xray_trace_id, in the X-Ray format, like 1-5759e988-bd862e3fe1be46a994272793.
+// Fields named like the header ones are prefixed with fields., like fields.level.
+type AWSEncoder struct{}
+
+var awsReserved = map[string]bool{
+	"timestamp": true, "level": true, "message": true, "logger": true, "xray_trace_id": true, SpanIDField: true,
+}
+
+// Encode implements Encoder
+func (AWSEncoder) Encode(buf *bytes.Buffer, e *Emitter, entry *Entry) {
+	buf.WriteString(`{"timestamp":"`)
+	buf.WriteString(entry.Time.UTC().Format("2006-01-02T15:04:05.000Z"))
+	buf.WriteString(`","level":"`)
+	buf.WriteString(upperLevel(entry.Level))
+	buf.WriteString(`","message":`)
+	writeJSONString(buf, entry.Message)
+	if entry.Tag != "" {
+		buf.WriteString(`,"logger":`)
+		writeJSONString(buf, entry.Tag)
+	}
+
+	traceID, spanID := writeCloudFields(buf, e, entry, awsReserved)
+	if traceID != "" {
+		buf.WriteString(`,"xray_trace_id":"1-`)
+		buf.WriteString(traceID[:8])
+		buf.WriteByte('-')
+		buf.WriteString(traceID[8:])
+		buf.WriteByte('"')
+	}
+	if spanID != "" {
+		buf.WriteString(`,"` + SpanIDField + `":"`)
+		buf.WriteString(spanID)
+		buf.WriteByte('"')
+	}
+	buf.WriteString("}\n")
+}
+
+// ECSEncoder renders entries as JSON documents following the Elastic Common Schema, one per line,
+// as expected by Filebeat and Elastic Agent.
+//
+// The header is written as @timestamp, log.level, message and log.logger, along with ecs.version.
+// The TraceIDField and SpanIDField fields are written as trace.id and span.id.
+// Fields named like the header ones are prefixed with fields., like fields.message.
+type ECSEncoder struct{}
+
+var ecsReserved = map[string]bool{
+	"@timestamp": true, "log.level": true, "message": true, "ecs.version": true, "log.logger": true,
+	"trace.id": true, "span.id": true,
+}
+
+// ecsVersion is the version of the Elastic Common Schema followed by ECSEncoder
+const ecsVersion = "1.6.0"
+
+// Encode implements Encoder
+func (ECSEncoder) Encode(buf *bytes.Buffer, e *Emitter, entry *Entry) {
+	buf.WriteString(`{"@timestamp":"`)
+	buf.WriteString(entry.Time.UTC().Format("2006-01-02T15:04:05.000Z"))
+	buf.WriteString(`","log.level":`)
+	writeJSONString(buf, entry.Level.String())
+	buf.WriteString(`,"message":`)
+	writeJSONString(buf, entry.Message)
+	buf.WriteString(`,"ecs.version":"` + ecsVersion + `"`)
+	if entry.Tag != "" {
+		buf.WriteString(`,"log.logger":`)
+		writeJSONString(buf, entry.Tag)
+	}
+
+	traceID, spanID := writeCloudFields(buf, e, entry, ecsReserved)
+	if traceID != "" {
+		buf.WriteString(`,"trace.id":"`)
+		buf.WriteString(traceID)
+		buf.WriteByte('"')
+	}
+	if spanID != "" {
+		buf.WriteString(`,"span.id":"`)
+		buf.WriteString(spanID)
+		buf.WriteByte('"')
+	}
+	buf.WriteString("}\n")
+}
+
+// writeCloudFields writes the context and entry fields as JSON, prefixing the reserved names,
+// except the valid trace context fields, which are returned as hex strings for the encoder to name
+func writeCloudFields(buf *bytes.Buffer, e *Emitter, entry *Entry, reserved map[string]bool) (traceID, spanID string) {
+	for _, fields := range [2][]interface{}{e.fields, entry.Fields} {
+		for i := 0; i+1 < len(fields); i += 2 {
+			key := keyString(fields[i])
+			switch key {
+			case TraceIDField:
+				if id := traceContextID(fields[i+1], 16); id != "" {
+					traceID = id
+					continue
+				}
+			case SpanIDField:
+				if id := traceContextID(fields[i+1], 8); id != "" {
+					spanID = id
+					continue
+				}
+			}
+			if reserved[key] {
+				writeFields(buf, cloudFieldPrefix+key, fields[i+1])
+				continue
+			}
+			writeFields(buf, fields[i], fields[i+1])
+		}
+	}
+	return traceID, spanID
+}
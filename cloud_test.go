@@ -0,0 +1,154 @@
+package log_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func TestCloudEncoders(t *testing.T) {
+	e := log.New(log.WithFields("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736", "request", "abc"))
+	entry := &log.Entry{
+		Time:    time.Date(2024, 3, 1, 10, 0, 0, 123456789, time.FixedZone("BRT", -3*3600)),
+		Tag:     "http",
+		Level:   log.Warn,
+		Message: "slow request",
+		Fields:  []interface{}{"span_id", "00f067aa0ba902b7", "status", 200},
+	}
+
+	tests := []struct {
+		Name    string
+		Encoder log.Encoder
+		Want    string
+	}{
+		{
+			Name:    "GCP",
+			Encoder: log.GCPEncoder{ProjectID: "acme"},
+			Want: `{"severity":"WARNING","message":"slow request","time":"2024-03-01T13:00:00.123456789Z",` +
+				`"logging.googleapis.com/labels":{"tag":"http"},"request":"abc","status":200,` +
+				`"logging.googleapis.com/trace":"projects/acme/traces/4bf92f3577b34da6a3ce929d0e0e4736",` +
+				`"logging.googleapis.com/spanId":"00f067aa0ba902b7"}`,
+		},
+		{
+			Name:    "AWS",
+			Encoder: log.AWSEncoder{},
+			Want: `{"timestamp":"2024-03-01T13:00:00.123Z","level":"WARN","message":"slow request","logger":"http",` +
+				`"request":"abc","status":200,"xray_trace_id":"1-4bf92f35-77b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`,
+		},
+		{
+			Name:    "ECS",
+			Encoder: log.ECSEncoder{},
+			Want: `{"@timestamp":"2024-03-01T13:00:00.123Z","log.level":"warn","message":"slow request","ecs.version":"1.6.0",` +
+				`"log.logger":"http","request":"abc","status":200,"trace.id":"4bf92f3577b34da6a3ce929d0e0e4736","span.id":"00f067aa0ba902b7"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			test.Encoder.Encode(&buf, e, entry)
+			if got := buf.String(); got != test.Want+"\n" {
+				t.Errorf("\nwant: %s\ngot: %s", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestGCPEncoderSeverity(t *testing.T) {
+	defer setenv("GOOGLE_CLOUD_PROJECT", "")()
+
+	var buf bytes.Buffer
+	e := log.New(log.WithOutput(&buf), log.WithEncoder(log.GCPEncoder{}), log.WithLevel(log.Trace))
+	e.T("", "trace")
+	e.I("", "info", "trace_id", "invalid")
+	e.E("", "error", "trace_id", "4bf92f3577b34da6a3ce929d0e0e4736")
+	e.Emit("", log.Fatal, "fatal")
+
+	var got []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		got = append(got, string(line[:bytes.Index(line, []byte(`,"time"`))]))
+	}
+	want := []string{
+		`{"severity":"DEBUG","message":"trace"`,
+		`{"severity":"INFO","message":"info"`,
+		`{"severity":"ERROR","message":"error"`,
+		`{"severity":"CRITICAL","message":"fatal"`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("invalid documents: %s", buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("\nwant: %s\ngot: %s", want[i], got[i])
+		}
+	}
+
+	// invalid ids are kept as fields, and valid ones are not qualified without a project
+	if !bytes.Contains(buf.Bytes(), []byte(`"trace_id":"invalid"`)) ||
+		!bytes.Contains(buf.Bytes(), []byte(`"logging.googleapis.com/trace":"4bf92f3577b34da6a3ce929d0e0e4736"`)) {
+		t.Errorf("invalid trace fields: %s", buf.String())
+	}
+}
+
+func TestCloudEncodersReserved(t *testing.T) {
+	e := log.New(log.WithFields("message", "context", "level", 1))
+	entry := &log.Entry{
+		Time:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Level:   log.Info,
+		Message: "entry",
+		Fields:  []interface{}{"severity", "high", "@timestamp", "now", "span_id", "nope", "status", 200},
+	}
+
+	tests := []struct {
+		Name    string
+		Encoder log.Encoder
+		Want    string
+	}{
+		{
+			Name:    "GCP",
+			Encoder: log.GCPEncoder{},
+			Want: `{"severity":"INFO","message":"entry","time":"2024-03-01T10:00:00Z","fields.message":"context","level":1,` +
+				`"fields.severity":"high","@timestamp":"now","span_id":"nope","status":200}`,
+		},
+		{
+			Name:    "AWS",
+			Encoder: log.AWSEncoder{},
+			Want: `{"timestamp":"2024-03-01T10:00:00.000Z","level":"INFO","message":"entry","fields.message":"context","fields.level":1,` +
+				`"severity":"high","@timestamp":"now","fields.span_id":"nope","status":200}`,
+		},
+		{
+			Name:    "ECS",
+			Encoder: log.ECSEncoder{},
+			Want: `{"@timestamp":"2024-03-01T10:00:00.000Z","log.level":"info","message":"entry","ecs.version":"1.6.0",` +
+				`"fields.message":"context","level":1,"severity":"high","fields.@timestamp":"now","span_id":"nope","status":200}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			test.Encoder.Encode(&buf, e, entry)
+			if got := buf.String(); got != test.Want+"\n" {
+				t.Errorf("\nwant: %s\ngot: %s", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestCloudConfig(t *testing.T) {
+	for format, want := range map[string]log.Encoder{
+		"gcp": log.GCPEncoder{},
+		"AWS": log.AWSEncoder{},
+		"ecs": log.ECSEncoder{},
+	} {
+		e, err := (&log.Config{Format: format}).New()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if e.Encoder != want {
+			t.Errorf("invalid encoder for %s: %T", format, e.Encoder)
+		}
+	}
+}
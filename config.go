@@ -0,0 +1,345 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes an Emitter. It is read from environment variables by ConfigFromEnv
+// and from JSON files by LoadConfig, which share the same schema:
+//
+//	{
+//		"level": "info",
+//		"format": "json",
+//		"time_format": "rfc3339",
+//		"output": "stderr",
+//		"tags": {"http": "warn", "db": "trace"},
+//		"redact": ["password", "token"],
+//		"drop": "tag == \"http\" && path == \"/healthz\""
+//	}
+//
+// Empty values keep the emitter defaults.
+type Config struct {
+	// Level is a level name, like "info"
+	Level string `json:"level"`
+
+	// Format is "json", "console", or a cloud platform preset: "gcp" for GCPEncoder,
+	// "aws" for AWSEncoder and "ecs" for ECSEncoder
+	Format string `json:"format"`
+
+	// TimeFormat is a time.Format layout or one of rfc3339, rfc3339nano, rfc1123 and stamp
+	TimeFormat string `json:"time_format"`
+
+	// Output is "stderr", "stdout" or the path of a file opened for appending
+	Output string `json:"output"`
+
+	// Tags maps tags to level names overriding Level, replacing the tag levels of the emitter
+	Tags map[string]string `json:"tags"`
+
+	// Redact lists the keys of fields whose values are replaced by "[REDACTED]"
+	Redact []string `json:"redact"`
+
+	// Drop is a filter expression of the entries to drop, see CompileFilter
+	Drop string `json:"drop"`
+
+	// hasDrop tells whether the file sets Drop, even to an empty expression
+	hasDrop bool
+}
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvConfig     = "LOG_CONFIG"
+	EnvLevel      = "LOG_LEVEL"
+	EnvFormat     = "LOG_FORMAT"
+	EnvTimeFormat = "LOG_TIME_FORMAT"
+	EnvOutput     = "LOG_OUTPUT"
+	EnvTags       = "LOG_TAGS"
+	EnvRedact     = "LOG_REDACT"
+	EnvDrop       = "LOG_DROP"
+)
+
+// ConfigFromEnv reads the configuration from the environment.
+//
+// When LOG_CONFIG names a file, it is loaded first and the other variables override it.
+// LOG_TAGS holds comma separated tag=level pairs, like "http=warn,db=trace",
+// and LOG_REDACT holds comma separated keys, like "password,token".
+func ConfigFromEnv() (*Config, error) {
+	c := &Config{}
+	if path := os.Getenv(EnvConfig); path != "" {
+		loaded, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		c = loaded
+	}
+
+	if v := os.Getenv(EnvLevel); v != "" {
+		c.Level = v
+	}
+	if v := os.Getenv(EnvFormat); v != "" {
+		c.Format = v
+	}
+	if v := os.Getenv(EnvTimeFormat); v != "" {
+		c.TimeFormat = v
+	}
+	if v := os.Getenv(EnvOutput); v != "" {
+		c.Output = v
+	}
+	if v := os.Getenv(EnvTags); v != "" {
+		if c.Tags == nil {
+			c.Tags = make(map[string]string)
+		}
+		for _, pair := range strings.Split(v, ",") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("log: %s: invalid tag level %q, want tag=level", EnvTags, pair)
+			}
+			c.Tags[kv[0]] = kv[1]
+		}
+	}
+	if v := os.Getenv(EnvDrop); v != "" {
+		c.Drop = v
+	}
+	if v := os.Getenv(EnvRedact); v != "" {
+		c.Redact = nil
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				c.Redact = append(c.Redact, key)
+			}
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadConfig reads the configuration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("log: reading config: %v", err)
+	}
+	c, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("log: %s: %v", path, err)
+	}
+	return c, nil
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err == nil {
+		_, c.hasDrop = keys["drop"]
+	}
+	return c, c.Validate()
+}
+
+// Validate checks every value of the configuration, without opening the output
+func (c *Config) Validate() error {
+	_, err := c.options(nil)
+	return err
+}
+
+// Options returns the options described by the configuration, opening the output file if there is one
+func (c *Config) Options() ([]Option, error) {
+	return c.options(openFile)
+}
+
+// New returns a new emitter built from the configuration
+func (c *Config) New() (*Emitter, error) {
+	options, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return New(options...), nil
+}
+
+// Apply configures the Default emitter, leaving it untouched when the configuration is invalid.
+//
+// The tag levels replace the current ones. The output file opened by the previous configuration
+// applied is reused when the path is the same, and closed when the output changes.
+func (c *Config) Apply() error {
+	return Default.apply(c)
+}
+
+// configOutput is the file opened by the last configuration applied to an emitter
+type configOutput struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// apply configures the emitter, reusing or closing the file opened by the previous configuration
+func (e *Emitter) apply(c *Config) error {
+	out := &e.sharedState().config
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	var file *os.File
+	options, err := c.options(func(path string) (*os.File, error) {
+		if out.file != nil && out.path == path {
+			file = out.file
+			return file, nil
+		}
+		f, err := openFile(path)
+		file = f
+		return f, err
+	})
+	if err != nil {
+		return err
+	}
+	e.Configure(options...)
+
+	if c.Output != "" && file != out.file {
+		if out.file != nil {
+			out.file.Close()
+		}
+		out.path, out.file = c.Output, file
+	}
+	return nil
+}
+
+// options returns the options of the configuration, opening the output file with open,
+// or only checking its path when open is nil
+func (c *Config) options(open func(path string) (*os.File, error)) ([]Option, error) {
+	var options []Option
+
+	if c.Level != "" {
+		level, err := ParseLevel(c.Level)
+		if err != nil {
+			return nil, fmt.Errorf("log: config level: unknown level %q", c.Level)
+		}
+		options = append(options, WithLevel(level))
+	}
+
+	switch strings.ToLower(c.Format) {
+	case "":
+	case "json":
+		options = append(options, WithEncoder(JSONEncoder{}))
+	case "console":
+		options = append(options, WithEncoder(ConsoleEncoder{}))
+	case "gcp":
+		options = append(options, WithEncoder(GCPEncoder{}))
+	case "aws":
+		options = append(options, WithEncoder(AWSEncoder{}))
+	case "ecs":
+		options = append(options, WithEncoder(ECSEncoder{}))
+	default:
+		return nil, fmt.Errorf("log: config format: unknown format %q, want json, console, gcp, aws or ecs", c.Format)
+	}
+
+	if c.TimeFormat != "" {
+		layout, err := parseTimeFormat(c.TimeFormat)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithTimeFormat(layout))
+	}
+
+	// sorted, so errors are reported consistently
+	tags := make([]string, 0, len(c.Tags))
+	for tag := range c.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	tagLevels := make(map[string]Level, len(tags))
+	for _, tag := range tags {
+		level, err := ParseLevel(c.Tags[tag])
+		if err != nil {
+			return nil, fmt.Errorf("log: config tag %q: unknown level %q", tag, c.Tags[tag])
+		}
+		tagLevels[tag] = level
+	}
+	if c.Tags != nil {
+		options = append(options, withTagLevels(tagLevels))
+	}
+
+	if len(c.Redact) > 0 {
+		options = append(options, WithRedact(c.Redact...))
+	}
+
+	if c.Drop != "" {
+		filter, err := CompileFilter(c.Drop)
+		if err != nil {
+			return nil, fmt.Errorf("log: config drop: %v", err)
+		}
+		options = append(options, WithDrop(filter))
+	}
+
+	if c.Output != "" {
+		output, err := openOutput(c.Output, open)
+		if err != nil {
+			return nil, err
+		}
+		if output != nil {
+			options = append(options, WithOutput(output))
+		}
+	}
+
+	return options, nil
+}
+
+var timeFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"stamp":       time.Stamp,
+}
+
+func parseTimeFormat(format string) (string, error) {
+	if layout, ok := timeFormats[strings.ToLower(format)]; ok {
+		return layout, nil
+	}
+	// a layout without any time element would write itself over and over
+	if time.Unix(0, 0).UTC().Format(format) == format {
+		return "", fmt.Errorf("log: config time format: %q is neither a known name nor a time layout", format)
+	}
+	return format, nil
+}
+
+// withTagLevels replaces the tag levels
+func withTagLevels(tags map[string]Level) Option {
+	return func(e *Emitter) {
+		e.TagLevels = tags
+	}
+}
+
+func openOutput(output string, open func(path string) (*os.File, error)) (io.Writer, error) {
+	switch strings.ToLower(output) {
+	case "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	}
+	if open == nil {
+		if strings.HasSuffix(output, string(os.PathSeparator)) {
+			return nil, errors.New("log: config output: invalid file path " + output)
+		}
+		return nil, nil
+	}
+	f, err := open(output)
+	if err != nil {
+		return nil, fmt.Errorf("log: config output: %v", err)
+	}
+	return f, nil
+}
+
+func openFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
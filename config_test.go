@@ -0,0 +1,196 @@
+package log_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	err = ioutil.WriteFile(path, []byte(`{"level":"warn","format":"console","tags":{"db":"trace"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer setenv(log.EnvConfig, path)()
+	defer setenv(log.EnvLevel, "debug")()
+	defer setenv(log.EnvTimeFormat, "RFC3339")()
+	defer setenv(log.EnvTags, "http=error, grpc=info")()
+	defer setenv(log.EnvRedact, "password, token")()
+
+	c, err := log.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &log.Config{
+		Level:      "debug",
+		Format:     "console",
+		TimeFormat: "RFC3339",
+		Tags:       map[string]string{"db": "trace", "http": "error", "grpc": "info"},
+		Redact:     []string{"password", "token"},
+	}
+	if !reflect.DeepEqual(want, c) {
+		t.Fatalf("\nwant: %+v\ngot: %+v", want, c)
+	}
+
+	e, err := c.New()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Level != log.Debug || e.TimeFormat != time.RFC3339 {
+		t.Errorf("invalid emitter: %+v", e)
+	}
+	if _, ok := e.Encoder.(log.ConsoleEncoder); !ok {
+		t.Errorf("invalid encoder: %T", e.Encoder)
+	}
+	wantTags := map[string]log.Level{"db": log.Trace, "http": log.Error, "grpc": log.Info}
+	if !reflect.DeepEqual(wantTags, e.TagLevels) {
+		t.Errorf("\nwant: %v\ngot: %v", wantTags, e.TagLevels)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		JSON string
+		Want string
+	}{
+		{Name: "Level", JSON: `{"level":"verbose"}`, Want: `log: config level: unknown level "verbose"`},
+		{Name: "Format", JSON: `{"format":"xml"}`, Want: `config format: unknown format "xml"`},
+		{Name: "Time Format", JSON: `{"time_format":"yesterday"}`, Want: `"yesterday" is neither a known name nor a time layout`},
+		{Name: "Tag", JSON: `{"tags":{"http":"loud"}}`, Want: `log: config tag "http": unknown level "loud"`},
+		{Name: "Unknown Field", JSON: `{"levle":"info"}`, Want: `unknown field "levle"`},
+		{Name: "Syntax", JSON: `{"level":`, Want: `unexpected EOF`},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "log.json")
+			if err := ioutil.WriteFile(path, []byte(tc.JSON), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = log.LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.Want) {
+				t.Errorf("invalid error:\nwant: %s\ngot: %v", tc.Want, err)
+			}
+		})
+	}
+
+	t.Run("Env Tags", func(t *testing.T) {
+		defer setenv(log.EnvTags, "http")()
+		if _, err := log.ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "want tag=level") {
+			t.Errorf("invalid error: %v", err)
+		}
+	})
+
+	t.Run("Env Level", func(t *testing.T) {
+		defer setenv(log.EnvLevel, "verbose")()
+		if c, err := log.ConfigFromEnv(); c != nil || err == nil {
+			t.Errorf("invalid result: %+v, %v", c, err)
+		}
+	})
+}
+
+// setenv sets the environment variable, returning a function restoring its previous value
+func setenv(key, value string) func() {
+	prev, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	sink := &bytes.Buffer{}
+	log.SetTestMode(true, sink)
+	defer log.SetTestMode(false)
+
+	if err := (&log.Config{Level: "nope"}).Apply(); err == nil {
+		t.Fatal("invalid config was applied")
+	}
+
+	c := &log.Config{Level: "warn", Tags: map[string]string{"db": "debug"}}
+	if err := c.Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	log.I("http", "hidden")
+	log.D("db", "shown")
+	log.C("db").T("hidden")
+
+	want := `{"tag":"db","level":"debug","msg":"shown"}` + "\n"
+	if got := sink.String(); got != want {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+
+	c = &log.Config{Tags: map[string]string{"http": "debug"}}
+	if err := c.Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]log.Level{"http": log.Debug}; !reflect.DeepEqual(want, log.Default.TagLevels) {
+		t.Errorf("tag levels were not replaced:\nwant: %v\ngot: %v", want, log.Default.TagLevels)
+	}
+}
+
+func TestConfigApplyOutput(t *testing.T) {
+	log.SetTestMode(true, ioutil.Discard)
+	defer log.SetTestMode(false)
+
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.log")
+	if err := (&log.Config{Output: path}).Apply(); err != nil {
+		t.Fatal(err)
+	}
+	first, ok := log.Default.Output.(*os.File)
+	if !ok {
+		t.Fatalf("invalid output: %T", log.Default.Output)
+	}
+	if err := (&log.Config{Output: path, Level: "debug"}).Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if log.Default.Output != first {
+		t.Error("the file was opened again")
+	}
+
+	if err := (&log.Config{Output: filepath.Join(dir, "b.log")}).Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if log.Default.Output == first {
+		t.Error("the output was not replaced")
+	}
+	if _, err := first.Write([]byte("late\n")); err == nil {
+		t.Error("the previous file was not closed")
+	}
+
+	if err := (&log.Config{Output: "stderr"}).Apply(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,79 @@
+package log
+
+import (
+	"net"
+	"time"
+)
+
+// retryInterval is how long the network outputs wait before dialing again after failing to
+const retryInterval = time.Second
+
+// redialer is a network connection dialed again when writing fails, at most once every retryInterval,
+// so a server being down costs the logging calls a dial attempt a second rather than one per entry.
+//
+// It is not safe for concurrent use, the outputs holding it being locked.
+type redialer struct {
+	dial    func() (net.Conn, error)
+	timeout time.Duration
+
+	conn    net.Conn
+	retry   time.Time
+	dialErr error
+}
+
+// connect dials unless already connected, or the last attempt failed less than retryInterval ago
+func (r *redialer) connect() error {
+	if r.conn != nil {
+		return nil
+	}
+	if time.Now().Before(r.retry) {
+		return r.dialErr
+	}
+	conn, err := r.dial()
+	if err != nil {
+		r.retry, r.dialErr = time.Now().Add(retryInterval), err
+		return err
+	}
+	r.conn = conn
+	return nil
+}
+
+// Write implements io.Writer with the timeout, dialing again once when writing fails
+func (r *redialer) Write(p []byte) (int, error) {
+	if err := r.connect(); err != nil {
+		return 0, err
+	}
+	r.conn.SetWriteDeadline(time.Now().Add(r.timeout))
+	if n, err := r.conn.Write(p); err == nil {
+		return n, nil
+	}
+
+	r.reset()
+	if err := r.connect(); err != nil {
+		return 0, err
+	}
+	r.conn.SetWriteDeadline(time.Now().Add(r.timeout))
+	n, err := r.conn.Write(p)
+	if err != nil {
+		r.reset()
+	}
+	return n, err
+}
+
+// reset closes the connection, so the next write dials again
+func (r *redialer) reset() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+// Close closes the connection
+func (r *redialer) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
@@ -1,21 +1,8 @@
 package log
 
-import (
-	"bytes"
-)
-
 // C creates a logging context
 func C(tag string, fields ...interface{}) *Context {
-	var buf bytes.Buffer
-	writeFields(&buf, fields...)
-	emitter := &Emitter{
-		Level:      Default.Level,
-		Output:     Default.Output,
-		TimeFormat: Default.TimeFormat,
-		Hook:       Default.Hook,
-		context:    buf.Bytes(),
-	}
-	return &Context{Emitter: emitter, Tag: tag}
+	return &Context{Emitter: Default.derive(fields...), Tag: tag}
 }
 
 // Context is a logging emitter wrapper with parsed context fields
@@ -37,17 +24,7 @@ type Context struct {
 
 // C returns a new context based on the current context
 func (c *Context) C(fields ...interface{}) *Context {
-	var buf bytes.Buffer
-	buf.Write(c.Emitter.context)
-	writeFields(&buf, fields...)
-	emitter := &Emitter{
-		Level:      c.Emitter.Level,
-		Output:     c.Emitter.Output,
-		TimeFormat: c.Emitter.TimeFormat,
-		Hook:       c.Emitter.Hook,
-		context:    buf.Bytes(),
-	}
-	return &Context{Emitter: emitter, Tag: c.Tag}
+	return &Context{Emitter: c.Emitter.derive(fields...), Tag: c.Tag}
 }
 
 // T logs a message when the Level is set to Trace
@@ -55,6 +32,11 @@ func (c *Context) T(message string, fields ...interface{}) {
 	c.Emitter.Emit(c.Tag, Trace, message, fields...)
 }
 
+// D logs a message when the Level is set to Debug or lower
+func (c *Context) D(message string, fields ...interface{}) {
+	c.Emitter.Emit(c.Tag, Debug, message, fields...)
+}
+
 // I logs a message when the Level is set to Info or lower
 func (c *Context) I(message string, fields ...interface{}) {
 	c.Emitter.Emit(c.Tag, Info, message, fields...)
@@ -70,8 +52,19 @@ func (c *Context) E(message string, fields ...interface{}) {
 	c.Emitter.Emit(c.Tag, Error, message, fields...)
 }
 
-// F logs a message when the Level is set to Fatal or lower
+// Log logs a message with any level, including the custom ones added by RegisterLevel
+func (c *Context) Log(level Level, message string, fields ...interface{}) {
+	c.Emitter.Emit(c.Tag, level, message, fields...)
+}
+
+// P logs a message when the Level is set to Panic or lower, and then panics with the message
+func (c *Context) P(message string, fields ...interface{}) {
+	c.Emitter.Emit(c.Tag, Panic, message, fields...)
+	panic(message)
+}
+
+// F logs a message when the Level is set to Fatal or lower, and then halts the application
 func (c *Context) F(message string, fields ...interface{}) {
 	c.Emitter.Emit(c.Tag, Fatal, message, fields...)
-	_exit(1)
+	c.Emitter.exit()
 }
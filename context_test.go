@@ -71,13 +71,15 @@ func TestContext(t *testing.T) {
 			Level:   log.Trace,
 			Emit: []Emit{
 				{Level: log.Trace, Message: "m1"},
-				{Level: log.Info, Message: "m2"},
-				{Level: log.Fatal, Message: "m3"},
+				{Level: log.Debug, Message: "m2"},
+				{Level: log.Info, Message: "m3"},
+				{Level: log.Fatal, Message: "m4"},
 			},
 			Want: []map[string]interface{}{
-				{"tag": "TAG", "one": "first", "two": "second", "level": "debug", "msg": "m1"},
-				{"tag": "TAG", "one": "first", "two": "second", "level": "info", "msg": "m2"},
-				{"tag": "TAG", "one": "first", "two": "second", "level": "fatal", "msg": "m3"},
+				{"tag": "TAG", "one": "first", "two": "second", "level": "trace", "msg": "m1"},
+				{"tag": "TAG", "one": "first", "two": "second", "level": "debug", "msg": "m2"},
+				{"tag": "TAG", "one": "first", "two": "second", "level": "info", "msg": "m3"},
+				{"tag": "TAG", "one": "first", "two": "second", "level": "fatal", "msg": "m4"},
 			},
 			ExitCode: 1,
 		},
@@ -89,6 +91,8 @@ func TestContext(t *testing.T) {
 				switch emit.Level {
 				case log.Trace:
 					tc.Context.T(emit.Message, emit.Fields...)
+				case log.Debug:
+					tc.Context.D(emit.Message, emit.Fields...)
 				case log.Info:
 					tc.Context.I(emit.Message, emit.Fields...)
 				case log.Warn:
@@ -2,31 +2,97 @@ package log
 
 import (
 	"bytes"
-	"fmt"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// New returns a new logging emmitter
+// New returns a new logging emmitter configured by the given options
 //
-// The standard output is os.Stderr.
+// The standard output is os.Stderr and the standard level is Info.
 //
 // The most used time format is time.RFC3339.
-// However, if your logs are shipped via syslog, you can omit the time format.
-func New(output io.Writer, timeFormat string) *Emitter {
-	return &Emitter{Output: output, TimeFormat: timeFormat}
+// However, if your logs are shipped via syslog, like with NewSyslog, you can omit the time format.
+func New(options ...Option) *Emitter {
+	e := &Emitter{Level: Info, Output: os.Stderr, shared: &shared{}}
+	e.Configure(options...)
+	return e
 }
 
 // Emitter is the base logging type
 type Emitter struct {
-	Level      Level
-	Output     io.Writer
+	Level Level
+
+	// Output receives the entries. Writers not safe for concurrent use are locked,
+	// either by WithOutput and Locked or when writing to them, as many goroutines write to them.
+	Output io.Writer
+
 	TimeFormat string
 	Hook       Hook
 
-	// parsed fields
+	// LevelFormat selects how levels are spelled, lower case names by default
+	LevelFormat LevelFormat
+
+	// ExitCode is the code used when halting after a Fatal logging, 1 when zero
+	ExitCode int
+
+	// Exit halts the application after a Fatal logging, os.Exit when nil
+	Exit func(code int)
+
+	// Encoder renders the entries, JSONEncoder when nil
+	Encoder Encoder
+
+	// TagLevels overrides the Level for specific tags
+	TagLevels map[string]Level
+
+	// Fallback receives the entries the Output fails to write. The entries written
+	// by some of the outputs of a Tee or a Router are only reported, not duplicated.
+	Fallback io.Writer
+
+	// OnWriteError receives the errors writing to the Output,
+	// which are written to os.Stderr at most once every ten seconds when nil
+	OnWriteError func(err error)
+
+	// Drop drops the entries matching the filter, before redaction, hooks and outputs
+	Drop *Filter
+
+	// Hooks are called in order with every entry before it is encoded
+	Hooks []EntryHook
+
+	// OnHookError receives the errors returned by Hooks, which are written to os.Stderr when nil
+	OnHookError func(err error)
+
+	// context fields, also kept parsed as JSON
+	fields  []interface{}
 	context []byte
+
+	// redactCache keeps the redacted context, created along with the context fields
+	redactCache *atomic.Value // *redactedContext
+
+	redact map[string]bool
+	shared *shared
+}
+
+// derive returns a copy of the emitter with the given fields appended to its context
+func (e *Emitter) derive(fields ...interface{}) *Emitter {
+	e.sharedState()
+	derived := *e
+	derived.addFields(fields...)
+	return &derived
+}
+
+func (e *Emitter) addFields(fields ...interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	buf.Write(e.context)
+	writeFields(&buf, fields...)
+	e.context = buf.Bytes()
+	e.fields = append(e.fields[:len(e.fields):len(e.fields)], fields...)
+	e.redactCache = new(atomic.Value)
 }
 
 // T logs a formatted message when the Level is set to Trace
@@ -34,6 +100,11 @@ func (e *Emitter) T(tag string, message string, fields ...interface{}) {
 	e.Emit(tag, Trace, message, fields...)
 }
 
+// D logs a formatted message when the Level is set to Debug or lower
+func (e *Emitter) D(tag string, message string, fields ...interface{}) {
+	e.Emit(tag, Debug, message, fields...)
+}
+
 // I logs a formatted message when the Level is set to Info or lower
 func (e *Emitter) I(tag string, message string, fields ...interface{}) {
 	e.Emit(tag, Info, message, fields...)
@@ -49,136 +120,171 @@ func (e *Emitter) E(tag string, message string, fields ...interface{}) {
 	e.Emit(tag, Error, message, fields...)
 }
 
-// F logs a formatted message when the Level is set to Fatal or lower
+// P logs a formatted message when the Level is set to Panic or lower, and then panics with the message.
+//
+// Like F halting, P panics even when the level filters the message out.
+func (e *Emitter) P(tag string, message string, fields ...interface{}) {
+	e.Emit(tag, Panic, message, fields...)
+	panic(message)
+}
+
+// F logs a formatted message when the Level is set to Fatal or lower.
+//
+// The exit handlers are called and the output is closed before the application halts,
+// except in testing mode.
 func (e *Emitter) F(tag string, message string, fields ...interface{}) {
 	e.Emit(tag, Fatal, message, fields...)
-	_exit(1)
+	e.exit()
+}
+
+// Enabled tells whether an entry with the given tag and level would be emitted
+func (e *Emitter) Enabled(tag string, level Level) bool {
+	min, tags := e.Level, e.TagLevels
+	if r := e.loadRules(); r != nil {
+		if r.hasLevel {
+			min = r.level
+		}
+		if r.tags != nil {
+			tags = r.tags
+		}
+	}
+	if l, ok := tags[tag]; ok {
+		min = l
+	}
+	if e.shared != nil {
+		if boost := atomic.LoadInt32(&e.shared.boost); boost != 0 && Level(boost-1) < min {
+			min = Level(boost - 1)
+		}
+	}
+	return level >= min
 }
 
 // Emit formats and writes a logging message to the emitters' output
 func (e *Emitter) Emit(tag string, level Level, message string, fields ...interface{}) {
-	if level < e.Level {
+	if !e.Enabled(tag, level) {
 		return
 	}
 
-	buf := pool.Get().(*bytes.Buffer)
+	entry := entryPool.Get().(*Entry)
+	*entry = Entry{Time: time.Now(), Tag: tag, Level: level, Message: message, Fields: fields, context: e.fields}
+
+	// the filter sees the values before redaction
+	if drop := e.dropFilter(); drop != nil && drop.Match(entry) {
+		releaseEntry(entry)
+		return
+	}
 
-	// start document
-	buf.WriteByte('{')
+	// redaction may need a copy of the context fields
+	ctx := e
+	redact := e.redaction()
+	if len(redact) > 0 {
+		entry.Fields = redactFields(redact, entry.Fields)
+		ctx = e.redactContext(redact)
+		entry.context = ctx.fields
+	}
 
-	// time
-	if e.TimeFormat != "" {
-		buf.WriteString(`"time":"`)
-		buf.WriteString(time.Now().Format(e.TimeFormat))
-		buf.WriteString(`",`)
+	// entry hooks may change or drop the entry
+	if len(e.Hooks) > 0 {
+		if !e.fireHooks(entry) {
+			releaseEntry(entry)
+			return
+		}
+		if len(redact) > 0 {
+			entry.Fields = redactFields(redact, entry.Fields)
+		}
 	}
 
-	// tag
-	buf.WriteString(`"tag":"`)
-	buf.WriteString(tag)
-	buf.WriteString(`",`)
+	// entry writers encode by themselves, unless the hook or the recorder need the document
+	rec := e.loadRecorder()
+	_, isEntryWriter := e.Output.(EntryWriter)
 
-	// level
-	buf.WriteString(`"level":`)
-	buf.WriteByte('"')
-	buf.WriteString(level.String())
-	buf.WriteByte('"')
+	var buf *bytes.Buffer
+	if !isEntryWriter || e.Hook != nil || rec != nil {
+		buf = e.encode(ctx, entry)
 
-	// message
-	buf.WriteString(`,"msg":`)
-	writeJSONString(buf, message)
+		if rec != nil {
+			rec.add(buf.Bytes())
+		}
 
-	// fields
-	if e.context != nil {
-		buf.Write(e.context)
+		// call hook
+		if e.Hook != nil {
+			b := buf.Bytes()
+			e.Hook(entry.Level, b)
+		}
 	}
-	writeFields(buf, fields...)
 
-	// end document
-	buf.WriteByte('}')
-	buf.WriteByte('\n')
+	if err := e.write(ctx, entry, buf); err != nil {
+		if buf == nil {
+			buf = e.encode(ctx, entry)
+		}
+		e.writeFailed(err, buf.Bytes())
+	}
 
-	// call hook
-	if e.Hook != nil {
-		b := buf.Bytes()
-		e.Hook(level, b)
+	if buf != nil {
+		buf.Reset()
+		pool.Put(buf)
 	}
+	releaseEntry(entry)
+}
 
-	buf.WriteTo(e.Output)
-	pool.Put(buf)
+// write writes the entry to the output, the document being encoded unless the output is an EntryWriter
+func (e *Emitter) write(ctx *Emitter, entry *Entry, buf *bytes.Buffer) error {
+	out := e.Output
+	if mu := e.outputLock(out); mu != nil {
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	switch w := out.(type) {
+	case nil:
+		return ErrNoOutput
+	case EntryWriter:
+		return w.WriteEntry(ctx, entry)
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
 }
 
-// Hook defines an emitter hook
-type Hook func(Level, []byte)
+// encode renders the entry into a pooled buffer
+func (e *Emitter) encode(ctx *Emitter, entry *Entry) *bytes.Buffer {
+	buf := pool.Get().(*bytes.Buffer)
+	e.encoder().Encode(buf, ctx, entry)
+	return buf
+}
 
-func writeFields(buf *bytes.Buffer, fields ...interface{}) {
-	for field := 0; field < len(fields); field += 2 {
-		// WriteString is slower in this codepath
-		buf.WriteByte(',')
-
-		// Key
-		buf.WriteByte('"')
-		switch k := fields[field].(type) {
-		case string:
-			buf.WriteString(k)
-		case fmt.Stringer:
-			buf.WriteString(k.String())
-		default:
-			fmt.Fprintf(buf, `%v`, k)
-		}
+func releaseEntry(entry *Entry) {
+	*entry = Entry{}
+	entryPool.Put(entry)
+}
 
-		buf.WriteString(`":`)
-
-		// Value
-		switch val := fields[field+1].(type) {
-		case string:
-			writeJSONString(buf, val)
-		case []byte:
-			writeJSONString(buf, string(val))
-		case fmt.Stringer:
-			writeJSONString(buf, val.String())
-		case byte, int, int8, int16, int32, int64, float32, float64, bool, uint, uint16, uint32, uint64:
-			fmt.Fprintf(buf, `%v`, val)
-		case error:
-			writeJSONString(buf, val.Error())
-		default:
-			writeJSONString(buf, fmt.Sprintf(`%v`, val))
-		}
+func (e *Emitter) encoder() Encoder {
+	if e.Encoder != nil {
+		return e.Encoder
 	}
+	return JSONEncoder{}
 }
 
-func writeJSONString(buf *bytes.Buffer, s string) {
-	buf.WriteByte('"')
-	for i := 0; i < len(s); i++ {
-		b := s[i]
-		switch b {
-		case '"', '\\':
-			buf.WriteByte('\\')
-			buf.WriteByte(b)
-		case '\b':
-			buf.WriteByte('\\')
-			buf.WriteByte('b')
-		case '\f':
-			buf.WriteByte('\\')
-			buf.WriteByte('f')
-		case '\n':
-			buf.WriteByte('\\')
-			buf.WriteByte('n')
-		case '\r':
-			buf.WriteByte('\\')
-			buf.WriteByte('r')
-		case '\t':
-			buf.WriteByte('\\')
-			buf.WriteByte('t')
-		default:
-			buf.WriteByte(b)
-		}
-	}
-	buf.WriteByte('"')
+// EntryWriter is an output receiving entries instead of encoded documents, so it can encode them its own way.
+//
+// The emitter is the one logging the entry, holding the context fields and the encoding settings.
+// The entry is reused once WriteEntry returns, so writers keeping it must keep a Clone instead.
+type EntryWriter interface {
+	WriteEntry(e *Emitter, entry *Entry) error
 }
 
+// Hook defines an emitter hook, called with every encoded entry.
+//
+// The document is reused once the hook returns, so hooks keeping it,
+// for instance to send it asynchronously, must copy it or be wrapped with CopyHook.
+type Hook func(Level, []byte)
+
 var pool = sync.Pool{
 	New: func() interface{} {
 		return &bytes.Buffer{}
 	},
 }
+
+var entryPool = sync.Pool{
+	New: func() interface{} {
+		return &Entry{}
+	},
+}
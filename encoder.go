@@ -0,0 +1,222 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encoder renders entries to the output
+type Encoder interface {
+	// Encode appends the entry, including the emitter context fields and a trailing line break, to buf
+	Encode(buf *bytes.Buffer, e *Emitter, entry *Entry)
+}
+
+// JSONEncoder renders entries as JSON documents, one per line. This is the default encoder.
+type JSONEncoder struct{}
+
+// Encode implements Encoder
+func (JSONEncoder) Encode(buf *bytes.Buffer, e *Emitter, entry *Entry) {
+	// start document
+	buf.WriteByte('{')
+
+	// time
+	if e.TimeFormat != "" {
+		buf.WriteString(`"time":"`)
+		buf.WriteString(entry.Time.Format(e.TimeFormat))
+		buf.WriteString(`",`)
+	}
+
+	// tag
+	buf.WriteString(`"tag":"`)
+	buf.WriteString(entry.Tag)
+	buf.WriteString(`",`)
+
+	// level
+	buf.WriteString(`"level":`)
+	e.writeLevel(buf, entry.Level)
+
+	// message
+	buf.WriteString(`,"msg":`)
+	writeJSONString(buf, entry.Message)
+
+	// fields
+	if e.context != nil {
+		buf.Write(e.context)
+	}
+	writeFields(buf, entry.Fields...)
+
+	// end document
+	buf.WriteByte('}')
+	buf.WriteByte('\n')
+}
+
+// ConsoleEncoder renders entries as human friendly lines, like
+//
+//	2018-06-01T10:00:00Z INFO  [TAG] start one=1 two="second value"
+//
+// The level is always written in upper case.
+type ConsoleEncoder struct{}
+
+// Encode implements Encoder
+func (ConsoleEncoder) Encode(buf *bytes.Buffer, e *Emitter, entry *Entry) {
+	if e.TimeFormat != "" {
+		buf.WriteString(entry.Time.Format(e.TimeFormat))
+		buf.WriteByte(' ')
+	}
+
+	level := upperLevel(entry.Level)
+	buf.WriteString(level)
+	for i := len(level); i < 5; i++ {
+		buf.WriteByte(' ')
+	}
+
+	buf.WriteString(" [")
+	buf.WriteString(entry.Tag)
+	buf.WriteString("] ")
+	buf.WriteString(entry.Message)
+
+	writeTextFields(buf, e.fields...)
+	writeTextFields(buf, entry.Fields...)
+	buf.WriteByte('\n')
+}
+
+func upperLevel(level Level) string {
+	if def := levels[level]; def.upper != "" {
+		return def.upper
+	}
+	return strings.ToUpper(level.String())
+}
+
+func (e *Emitter) writeLevel(buf *bytes.Buffer, level Level) {
+	switch e.LevelFormat {
+	case LevelSeverity:
+		buf.WriteString(strconv.Itoa(level.Severity()))
+	case LevelUpper:
+		buf.WriteByte('"')
+		buf.WriteString(upperLevel(level))
+		buf.WriteByte('"')
+	default:
+		buf.WriteByte('"')
+		buf.WriteString(level.String())
+		buf.WriteByte('"')
+	}
+}
+
+func writeFields(buf *bytes.Buffer, fields ...interface{}) {
+	for field := 0; field < len(fields); field += 2 {
+		// WriteString is slower in this codepath
+		buf.WriteByte(',')
+
+		// Key
+		buf.WriteByte('"')
+		switch k := fields[field].(type) {
+		case string:
+			buf.WriteString(k)
+		case fmt.Stringer:
+			buf.WriteString(k.String())
+		default:
+			fmt.Fprintf(buf, `%v`, k)
+		}
+
+		buf.WriteString(`":`)
+
+		// Value
+		switch val := fields[field+1].(type) {
+		case string:
+			writeJSONString(buf, val)
+		case []byte:
+			writeJSONString(buf, string(val))
+		case fmt.Stringer:
+			writeJSONString(buf, val.String())
+		case byte, int, int8, int16, int32, int64, float32, float64, bool, uint, uint16, uint32, uint64:
+			fmt.Fprintf(buf, `%v`, val)
+		case error:
+			writeJSONString(buf, val.Error())
+		default:
+			writeJSONString(buf, fmt.Sprintf(`%v`, val))
+		}
+	}
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch b {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(b)
+		case '\b':
+			buf.WriteByte('\\')
+			buf.WriteByte('b')
+		case '\f':
+			buf.WriteByte('\\')
+			buf.WriteByte('f')
+		case '\n':
+			buf.WriteByte('\\')
+			buf.WriteByte('n')
+		case '\r':
+			buf.WriteByte('\\')
+			buf.WriteByte('r')
+		case '\t':
+			buf.WriteByte('\\')
+			buf.WriteByte('t')
+		default:
+			buf.WriteByte(b)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+func writeTextFields(buf *bytes.Buffer, fields ...interface{}) {
+	for field := 0; field < len(fields); field += 2 {
+		buf.WriteByte(' ')
+		buf.WriteString(keyString(fields[field]))
+		buf.WriteByte('=')
+		writeTextValue(buf, valueString(fields[field+1]))
+	}
+}
+
+func keyString(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case fmt.Stringer:
+		return k.String()
+	default:
+		return fmt.Sprintf(`%v`, k)
+	}
+}
+
+func valueString(value interface{}) string {
+	switch val := value.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case fmt.Stringer:
+		return val.String()
+	case error:
+		return val.Error()
+	default:
+		return fmt.Sprintf(`%v`, val)
+	}
+}
+
+// writeTextValue quotes the value only when it would be ambiguous otherwise
+func writeTextValue(buf *bytes.Buffer, s string) {
+	if s == "" {
+		buf.WriteString(`""`)
+		return
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '"' || r == '=' || r == utf8.RuneError {
+			buf.WriteString(strconv.Quote(s))
+			return
+		}
+	}
+	buf.WriteString(s)
+}
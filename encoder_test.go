@@ -0,0 +1,28 @@
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func TestConsoleEncoder(t *testing.T) {
+	sink := &bytes.Buffer{}
+	logger := log.New(
+		log.WithOutput(sink),
+		log.WithLevel(log.Trace),
+		log.WithEncoder(log.ConsoleEncoder{}),
+		log.WithFields("app", "test"),
+	)
+
+	logger.I("TAG", "start", "one", 1, "two", "second value", "err", errors.New(`bad "thing"`), "empty", "")
+	logger.T("TAG", "more")
+
+	want := `INFO  [TAG] start app=test one=1 two="second value" err="bad \"thing\"" empty=""` + "\n" +
+		`TRACE [TAG] more app=test` + "\n"
+	if got := sink.String(); got != want {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"time"
+)
+
+// Entry is a logging message on its way to be encoded
+type Entry struct {
+	Time    time.Time
+	Tag     string
+	Level   Level
+	Message string
+
+	// Fields are the key/value pairs given when logging.
+	// Use Add to append fields, as the slice may belong to the caller.
+	Fields []interface{}
+
+	// context fields of the emitter
+	context []interface{}
+}
+
+// Context returns the context fields of the emitter, which must not be modified
+func (entry *Entry) Context() []interface{} {
+	return entry.context
+}
+
+// Get returns the value of a field, looking at Fields first and then at the context fields
+func (entry *Entry) Get(key string) (interface{}, bool) {
+	for _, fields := range [2][]interface{}{entry.Fields, entry.context} {
+		for field := len(fields) - 2; field >= 0; field -= 2 {
+			if keyString(fields[field]) == key {
+				return fields[field+1], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Add appends a field to the entry, without touching the slice given when logging
+func (entry *Entry) Add(key string, value interface{}) {
+	n := len(entry.Fields)
+	entry.Fields = append(entry.Fields[:n:n], key, value)
+}
+
+// Clone returns a copy of the entry which may be kept after Emit returns
+func (entry *Entry) Clone() *Entry {
+	clone := *entry
+	// the context fields are never changed in place, only the call fields need a copy
+	clone.Fields = append([]interface{}(nil), entry.Fields...)
+	return &clone
+}
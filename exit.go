@@ -0,0 +1,156 @@
+package log
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// RegisterExitHandler adds a function to be called before a Fatal logging halts the application,
+// and returns a function removing it.
+//
+// Handlers run in the order they were registered, and a panicking handler does not prevent
+// the others from running nor the application from halting. They are not called in testing mode.
+func RegisterExitHandler(handler func()) (unregister func()) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlersSeq++
+	id := handlersSeq
+	handlers = append(handlers, exitHandler{id, handler})
+
+	return func() {
+		handlersMu.Lock()
+		defer handlersMu.Unlock()
+		for i, h := range handlers {
+			if h.id == id {
+				handlers = append(handlers[:i:i], handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+type exitHandler struct {
+	id uint64
+	fn func()
+}
+
+var (
+	handlersMu  sync.Mutex
+	handlers    []exitHandler
+	handlersSeq uint64
+)
+
+func runExitHandlers() {
+	handlersMu.Lock()
+	hs := make([]exitHandler, len(handlers))
+	copy(hs, handlers)
+	handlersMu.Unlock()
+
+	for _, handler := range hs {
+		func() {
+			defer func() { recover() }()
+			handler.fn()
+		}()
+	}
+}
+
+// Syncer is implemented by outputs that buffer entries, like *os.File
+type Syncer interface {
+	Sync() error
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// Sync flushes the hooks and the output when they buffer entries, either by calling Sync or Flush
+func (e *Emitter) Sync() error {
+	var err error
+	for _, hook := range e.Hooks {
+		if herr := syncValue(hook); err == nil {
+			err = herr
+		}
+	}
+	if oerr := e.syncOutput(); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+func (e *Emitter) syncOutput() error {
+	out := e.Output
+	if mu := e.outputLock(out); mu != nil {
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	return syncValue(out)
+}
+
+// Close flushes the hooks and the output, and then closes the ones which are an io.Closer.
+//
+// The standard output and error are flushed but never closed.
+func (e *Emitter) Close() error {
+	err := e.Sync()
+	for _, hook := range e.Hooks {
+		if herr := closeValue(hook); err == nil {
+			err = herr
+		}
+	}
+	if isStdStream(e.Output) {
+		return err
+	}
+	if oerr := e.closeOutput(); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+func (e *Emitter) closeOutput() error {
+	out := e.Output
+	if mu := e.outputLock(out); mu != nil {
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	return closeValue(out)
+}
+
+func isStdStream(w io.Writer) bool {
+	return w == os.Stdout || w == os.Stderr
+}
+
+func syncValue(v interface{}) error {
+	switch s := v.(type) {
+	case Syncer:
+		return s.Sync()
+	case flusher:
+		return s.Flush()
+	}
+	return nil
+}
+
+func closeValue(v interface{}) error {
+	if closer, ok := v.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// exit halts the application after running the exit handlers and closing the output,
+// which are skipped in testing mode
+func (e *Emitter) exit() {
+	if !_testMode {
+		runExitHandlers()
+		e.Close()
+	}
+
+	code := e.ExitCode
+	if code == 0 {
+		code = 1
+	}
+	if e.Exit != nil {
+		e.Exit(code)
+		return
+	}
+	_exit(code)
+}
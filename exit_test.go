@@ -0,0 +1,106 @@
+package log_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+	synced bool
+	closed bool
+}
+
+func (b *closingBuffer) Sync() error {
+	b.synced = true
+	return nil
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestFatal(t *testing.T) {
+	var calls []string
+	defer log.RegisterExitHandler(func() { calls = append(calls, "first") })()
+	defer log.RegisterExitHandler(func() { panic("broken handler") })()
+	unregister := log.RegisterExitHandler(func() { calls = append(calls, "removed") })
+	defer log.RegisterExitHandler(func() { calls = append(calls, "last") })()
+	unregister()
+	unregister()
+
+	code := 0
+	out := &closingBuffer{}
+	e := &log.Emitter{
+		Output:   out,
+		ExitCode: 3,
+		Exit:     func(c int) { code = c },
+	}
+	e.F("test", "goodbye")
+
+	if code != 3 {
+		t.Errorf("invalid exit code:\nwant: 3\ngot: %d", code)
+	}
+	if strings.Join(calls, ",") != "first,last" {
+		t.Errorf("invalid exit handlers calls: %v", calls)
+	}
+	if !out.synced || !out.closed {
+		t.Errorf("output was not flushed and closed: synced %v closed %v", out.synced, out.closed)
+	}
+	if want := `"level":"fatal","msg":"goodbye"`; !strings.Contains(out.String(), want) {
+		t.Errorf("invalid output:\nwant: %s\ngot: %s", want, out.String())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	sink := &bytes.Buffer{}
+	log.SetTestMode(true, sink)
+	defer log.SetTestMode(false)
+
+	defer func() {
+		r := recover()
+		if r != "boom" {
+			t.Errorf("invalid panic value:\nwant: boom\ngot: %v", r)
+		}
+		if want := `"level":"panic","msg":"boom","a":1`; !strings.Contains(sink.String(), want) {
+			t.Errorf("invalid output:\nwant: %s\ngot: %s", want, sink.String())
+		}
+	}()
+	log.C("test").P("boom", "a", 1)
+}
+
+func TestFatalTestMode(t *testing.T) {
+	called := false
+	defer log.RegisterExitHandler(func() { called = true })()
+
+	out := &closingBuffer{}
+	log.SetTestMode(true, out)
+	defer log.SetTestMode(false)
+
+	log.F("test", "goodbye")
+	if log.LastExitCode() != 1 {
+		t.Errorf("invalid exit code: %d", log.LastExitCode())
+	}
+	if called || out.closed {
+		t.Errorf("exit side effects ran in testing mode: handler %v, closed %v", called, out.closed)
+	}
+}
+
+func TestPanicFiltered(t *testing.T) {
+	sink := &bytes.Buffer{}
+	e := log.New(log.WithOutput(sink), log.WithLevel(log.Fatal))
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("invalid panic value:\nwant: boom\ngot: %v", r)
+		}
+		if sink.Len() != 0 {
+			t.Errorf("filtered entry was written: %s", sink.String())
+		}
+	}()
+	e.P("test", "boom")
+}
@@ -0,0 +1,433 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// backupTimeFormat is the time format used in the names of the rotated files
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+
+	// fileCheckInterval is how often the output checks whether its file was moved or deleted
+	fileCheckInterval = time.Second
+)
+
+// FileOptions configures OpenFile. The zero value never rotates the file.
+type FileOptions struct {
+	// MaxSize rotates the file before it grows past the given bytes, no limit when zero
+	MaxSize int64
+
+	// Interval rotates the file when the interval elapses, no limit when zero.
+	// The rotations happen at multiples of the interval since the zero time,
+	// so a 24 hours interval rotates at midnight UTC.
+	Interval time.Duration
+
+	// MaxBackups is how many rotated files are kept, all of them when zero
+	MaxBackups int
+
+	// MaxAge removes the rotated files older than the given duration, none of them when zero
+	MaxAge time.Duration
+
+	// Compress gzips the rotated files in the background
+	Compress bool
+
+	// Mode is the permission of new files, 0644 when zero
+	Mode os.FileMode
+
+	// NoReopenSignal disables reopening the file when the process receives a SIGHUP
+	NoReopenSignal bool
+
+	// OnError receives the errors compressing and removing the rotated files,
+	// which are written to os.Stderr when nil
+	OnError func(err error)
+}
+
+// FileOutput writes the entries to a file, rotating it by size or time.
+//
+// The common use case is
+//
+//	out, err := log.OpenFile("/var/log/app/app.log", log.FileOptions{
+//		MaxSize:    100 << 20,
+//		MaxBackups: 10,
+//		Compress:   true,
+//	})
+//	if err != nil {
+//		log.F("main", "could not open the log file", "err", err)
+//	}
+//	log.Configure(log.WithOutput(out))
+//
+// Rotated files are renamed after the time of the rotation, like app-2006-01-02T15-04-05.000.log,
+// with a counter like app-2006-01-02T15-04-05.000_1.log when the name is taken,
+// and gzipped ones get a .gz suffix.
+//
+// The file is reopened on SIGHUP, so external tools like logrotate can move it away,
+// and whenever it is moved or deleted, creating the directory again when needed.
+type FileOutput struct {
+	path    string
+	options FileOptions
+
+	mu      sync.Mutex
+	file    *os.File
+	info    os.FileInfo
+	size    int64
+	next    time.Time
+	checked time.Time
+	closed  bool
+
+	mill    chan struct{}
+	milled  sync.WaitGroup
+	signals chan os.Signal
+}
+
+// OpenFile opens or creates the file, appending to it
+func OpenFile(path string, options FileOptions) (*FileOutput, error) {
+	if options.Mode == 0 {
+		options.Mode = 0644
+	}
+
+	f := &FileOutput{path: path, options: options, mill: make(chan struct{}, 1)}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	f.milled.Add(1)
+	go f.runMill()
+
+	if !options.NoReopenSignal {
+		f.signals = make(chan os.Signal, 1)
+		signal.Notify(f.signals, syscall.SIGHUP)
+		go f.reopenOnSignal(f.signals)
+	}
+	return f, nil
+}
+
+// Write implements io.Writer, rotating the file when needed
+func (f *FileOutput) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.file == nil || f.moved() {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Concurrent implements ConcurrentWriter, as the file is locked
+func (f *FileOutput) Concurrent() bool {
+	return true
+}
+
+// Rotate renames the file after the current time and opens a new one
+func (f *FileOutput) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	return f.rotate()
+}
+
+// Reopen closes the file and opens it again, creating it when it was moved away
+func (f *FileOutput) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	return f.open()
+}
+
+// Sync commits the file to stable storage
+func (f *FileOutput) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file and waits for the rotated files to be compressed
+func (f *FileOutput) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	if f.signals != nil {
+		signal.Stop(f.signals)
+		close(f.signals)
+	}
+	close(f.mill)
+
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.milled.Wait()
+	return err
+}
+
+// open closes the current file, if any, and opens the path, the lock being held
+func (f *FileOutput) open() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, f.options.Mode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	now := time.Now()
+	f.file, f.info, f.size, f.checked = file, info, info.Size(), now
+
+	// an existing file is rotated once its interval elapses
+	if f.options.Interval > 0 {
+		start := now
+		if info.Size() > 0 {
+			start = info.ModTime()
+		}
+		f.next = start.Truncate(f.options.Interval).Add(f.options.Interval)
+	}
+	return nil
+}
+
+// moved tells whether the file was moved or deleted, checking at most once every fileCheckInterval
+func (f *FileOutput) moved() bool {
+	now := time.Now()
+	if now.Sub(f.checked) < fileCheckInterval {
+		return false
+	}
+	f.checked = now
+
+	info, err := os.Stat(f.path)
+	return err != nil || !os.SameFile(info, f.info)
+}
+
+// due tells whether writing the given bytes requires a rotation first
+func (f *FileOutput) due(n int) bool {
+	if f.options.MaxSize > 0 && f.size > 0 && f.size+int64(n) > f.options.MaxSize {
+		return true
+	}
+	if f.options.Interval > 0 {
+		now := time.Now()
+		if now.Before(f.next) {
+			return false
+		}
+		if f.size > 0 {
+			return true
+		}
+		// empty files are kept rather than rotated
+		f.next = now.Truncate(f.options.Interval).Add(f.options.Interval)
+	}
+	return false
+}
+
+// rotate renames the file and opens a new one, the lock being held
+func (f *FileOutput) rotate() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+
+	if err := os.Rename(f.path, f.backupName(time.Now())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	select {
+	case f.mill <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// backupName returns the name of a new backup, adding a counter when rotating twice within a millisecond
+func (f *FileOutput) backupName(t time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	stamp := prefix + t.Format(backupTimeFormat)
+	name := filepath.Join(dir, stamp+ext)
+	for n := 1; exists(name) || exists(name+".gz"); n++ {
+		name = filepath.Join(dir, stamp+"_"+strconv.Itoa(n)+ext)
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func (f *FileOutput) nameParts() (dir, prefix, ext string) {
+	dir, name := filepath.Split(f.path)
+	ext = filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext) + "-", ext
+}
+
+func (f *FileOutput) reopenOnSignal(signals chan os.Signal) {
+	for range signals {
+		f.mu.Lock()
+		if !f.closed {
+			if err := f.open(); err != nil {
+				f.error(err)
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// runMill compresses and removes the rotated files after every rotation
+func (f *FileOutput) runMill() {
+	defer f.milled.Done()
+	for range f.mill {
+		backups, err := f.backups()
+		if err != nil {
+			f.error(err)
+			continue
+		}
+
+		for i, b := range backups {
+			switch {
+			case f.options.MaxBackups > 0 && i >= f.options.MaxBackups,
+				f.options.MaxAge > 0 && time.Since(b.time) > f.options.MaxAge:
+				if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+					f.error(err)
+				}
+			case f.options.Compress && !strings.HasSuffix(b.path, ".gz"):
+				if err := compressFile(b.path); err != nil {
+					f.error(err)
+				}
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	path string
+	time time.Time
+	// seq orders the backups rotated within the same millisecond
+	seq int
+}
+
+// backups lists the rotated files, newest first
+func (f *FileOutput) backups() ([]backupFile, error) {
+	dir, prefix, ext := f.nameParts()
+	if dir == "" {
+		dir = "."
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".gz")
+		if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp, seq := name[len(prefix):len(name)-len(ext)], 0
+		if i := strings.IndexByte(stamp, '_'); i >= 0 {
+			if seq, err = strconv.Atoi(stamp[i+1:]); err != nil || seq < 1 {
+				continue
+			}
+			stamp = stamp[:i]
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, file.Name()), time: t, seq: seq})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].time.Equal(backups[j].time) {
+			return backups[i].time.After(backups[j].time)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	return backups, nil
+}
+
+// compressFile gzips the file and removes it
+func compressFile(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(path + ".gz")
+		}
+	}()
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (f *FileOutput) error(err error) {
+	if f.options.OnError != nil {
+		f.options.OnError(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "log: file output error: %v\n", err)
+}
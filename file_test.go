@@ -0,0 +1,195 @@
+package log_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFileOutputRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	out, err := log.OpenFile(path, log.FileOptions{MaxSize: 100, MaxBackups: 2, Compress: true, NoReopenSignal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := log.New(log.WithOutput(out))
+
+	// every entry is 49 bytes long, so the file rotates every two entries
+	for i := 0; i < 7; i++ {
+		e.I("test", "0123456789")
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := listDir(t, dir)
+	if len(names) != 3 || names[2] != "app.log" {
+		t.Fatalf("invalid files: %v", names)
+	}
+	for _, name := range names[:2] {
+		if !strings.HasPrefix(name, "app-") || !strings.HasSuffix(name, ".log.gz") {
+			t.Fatalf("invalid backup name: %s", name)
+		}
+
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(gz)
+		file.Close()
+		if err != nil || strings.Count(string(b), "\n") != 2 {
+			t.Errorf("invalid backup %s: %q, %v", name, b, err)
+		}
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	if strings.Count(string(b), "\n") != 1 {
+		t.Errorf("invalid current file: %q", b)
+	}
+}
+
+func TestFileOutputRotateSameTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	out, err := log.OpenFile(path, log.FileOptions{NoReopenSignal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := log.New(log.WithOutput(out))
+
+	// rotating faster than the millisecond precision of the backup names
+	for i := 0; i < 5; i++ {
+		e.I("test", "entry")
+		if err := out.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := listDir(t, dir)
+	if len(names) != 6 {
+		t.Fatalf("backups were overwritten: %v", names)
+	}
+	for _, name := range names {
+		if name == "app.log" {
+			continue
+		}
+		if b, _ := ioutil.ReadFile(filepath.Join(dir, name)); messages(string(b)) != "entry" {
+			t.Errorf("invalid backup %s: %q", name, b)
+		}
+	}
+}
+
+func TestFileOutputReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "app.log")
+	out, err := log.OpenFile(path, log.FileOptions{NoReopenSignal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out))
+
+	// like logrotate, moving the file away before asking for a reopen
+	e.I("test", "one")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	e.I("test", "two")
+	if err := out.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	e.I("test", "three")
+
+	if b, _ := ioutil.ReadFile(path + ".1"); messages(string(b)) != "one two" {
+		t.Errorf("invalid moved file: %q", b)
+	}
+	if b, _ := ioutil.ReadFile(path); messages(string(b)) != "three" {
+		t.Errorf("invalid reopened file: %q", b)
+	}
+
+	// the directory is created again once the output notices the file is gone
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	e.I("test", "four")
+
+	if b, _ := ioutil.ReadFile(path); messages(string(b)) != "four" {
+		t.Errorf("invalid recreated file: %q", b)
+	}
+}
+
+func TestFileOutputInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	out, err := log.OpenFile(path, log.FileOptions{Interval: 50 * time.Millisecond, NoReopenSignal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := log.New(log.WithOutput(out))
+
+	e.I("test", "one")
+	time.Sleep(60 * time.Millisecond)
+	e.I("test", "two")
+	out.Close()
+
+	if names := listDir(t, dir); len(names) != 2 {
+		t.Errorf("invalid files: %v", names)
+	}
+	if b, _ := ioutil.ReadFile(path); messages(string(b)) != "two" {
+		t.Errorf("invalid current file: %q", b)
+	}
+	if _, err := out.Write([]byte("late\n")); err != log.ErrClosed {
+		t.Errorf("invalid error after close: %v", err)
+	}
+}
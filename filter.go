@@ -0,0 +1,461 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled expression matching entries, see CompileFilter
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// CompileFilter compiles a filter expression over the entry tag, level, message and fields.
+//
+// Expressions compare a name with a literal, and combine comparisons with &&, || and !, like
+//
+//	tag == "http" && path == "/healthz"
+//	level < warn && (tag == "db" || msg =~ "^cache ")
+//	status >= 500
+//
+// The names tag, level and msg refer to the entry itself, any other name refers to a field,
+// including the context ones. Levels are compared by their names or numbers.
+// Fields compare as numbers with number literals, and by their text otherwise.
+// The operators are ==, !=, <, <=, >, >=, and the regular expression matches =~ and !~.
+// A comparison with a missing field is false, except for != and !~.
+func CompileFilter(expr string) (*Filter, error) {
+	p := &filterParser{expr: expr}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s, want && or ||", p.tok)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// MustCompileFilter is like CompileFilter but panics when the expression is invalid
+func MustCompileFilter(expr string) *Filter {
+	f, err := CompileFilter(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Match tells whether the entry matches the filter
+func (f *Filter) Match(entry *Entry) bool {
+	return f.root.match(entry)
+}
+
+// String returns the filter expression
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// WithDrop drops the entries matching the filter before they reach hooks and outputs.
+// The filter sees the field values before redaction.
+func WithDrop(filter *Filter) Option {
+	return func(e *Emitter) {
+		e.Drop = filter
+	}
+}
+
+type filterNode interface {
+	match(entry *Entry) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(entry *Entry) bool { return n.left.match(entry) && n.right.match(entry) }
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(entry *Entry) bool { return n.left.match(entry) || n.right.match(entry) }
+
+type notNode struct{ node filterNode }
+
+func (n notNode) match(entry *Entry) bool { return !n.node.match(entry) }
+
+// levelNode compares the entry level
+type levelNode struct {
+	op    string
+	level Level
+}
+
+func (n levelNode) match(entry *Entry) bool {
+	return compareOrder(n.op, int(entry.Level)-int(n.level))
+}
+
+// valueNode compares the tag, the message or a field with a literal
+type valueNode struct {
+	name   string
+	op     string
+	text   string
+	number float64
+	isNum  bool
+	re     *regexp.Regexp
+}
+
+func (n valueNode) match(entry *Entry) bool {
+	// the entry strings are not boxed and the fields are not turned into text unless needed,
+	// which would allocate
+	var value interface{}
+	var text string
+	isField := false
+	switch n.name {
+	case "tag":
+		text = entry.Tag
+	case "level":
+		text = entry.Level.String()
+	case "msg":
+		text = entry.Message
+	default:
+		v, ok := entry.Get(n.name)
+		if !ok {
+			return n.op == "!=" || n.op == "!~"
+		}
+		value, isField = v, true
+	}
+
+	if n.isNum {
+		f, ok := toFloat(value)
+		if !ok {
+			if isField {
+				text = valueString(value)
+			}
+			f, ok = parseFloat(text)
+		}
+		if !ok {
+			return n.op == "!="
+		}
+		switch {
+		case f < n.number:
+			return compareOrder(n.op, -1)
+		case f > n.number:
+			return compareOrder(n.op, 1)
+		}
+		return compareOrder(n.op, 0)
+	}
+
+	if isField {
+		text = valueString(value)
+	}
+	switch n.op {
+	case "=~":
+		return n.re.MatchString(text)
+	case "!~":
+		return !n.re.MatchString(text)
+	}
+	return compareOrder(n.op, strings.Compare(text, n.text))
+}
+
+// compareOrder applies the operator to the result of a comparison, negative when less
+func compareOrder(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func parseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+type tokenKind byte
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return "string " + strconv.Quote(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+type filterParser struct {
+	expr string
+	pos  int
+	tok  token
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("log: filter column %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// next reads the next token
+func (p *filterParser) next() error {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t' || p.expr[p.pos] == '\n') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.expr) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+
+	c := p.expr[p.pos]
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.expr) && isNameByte(p.expr[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokName, text: p.expr[start:p.pos], pos: start}
+
+	case c == '-' || c >= '0' && c <= '9':
+		p.pos++
+		for p.pos < len(p.expr) && (p.expr[p.pos] == '.' || p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.expr[start:p.pos], pos: start}
+
+	case c == '"' || c == '\'':
+		p.pos++
+		for p.pos < len(p.expr) && p.expr[p.pos] != c {
+			if p.expr[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.expr) {
+			p.tok = token{pos: start}
+			return p.errorf("unterminated string")
+		}
+		p.pos++
+		raw := p.expr[start:p.pos]
+		if c == '\'' {
+			raw = `"` + strings.Replace(raw[1:len(raw)-1], `"`, `\"`, -1) + `"`
+		}
+		text, err := strconv.Unquote(raw)
+		if err != nil {
+			p.tok = token{pos: start}
+			return p.errorf("invalid string %s", p.expr[start:p.pos])
+		}
+		p.tok = token{kind: tokString, text: text, pos: start}
+
+	default:
+		for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"} {
+			if strings.HasPrefix(p.expr[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return nil
+			}
+		}
+		p.tok = token{pos: start}
+		return p.errorf("unexpected character %q", c)
+	}
+	return nil
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *filterParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch {
+	case p.isOp("!"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+
+	case p.isOp("("):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, p.errorf("unexpected %s, want )", p.tok)
+		}
+		return node, p.next()
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	if p.tok.kind != tokName {
+		return nil, p.errorf("unexpected %s, want a name like tag, level, msg or a field", p.tok)
+	}
+	name := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	op := p.tok.text
+	switch {
+	case p.tok.kind != tokOp:
+		return nil, p.errorf("unexpected %s, want a comparison operator after %s", p.tok, name)
+	case op == "==", op == "!=", op == "<", op == "<=", op == ">", op == ">=", op == "=~", op == "!~":
+	default:
+		return nil, p.errorf("unexpected %s, want a comparison operator after %s", p.tok, name)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	lit := p.tok
+	if lit.kind != tokString && lit.kind != tokNumber && lit.kind != tokName {
+		return nil, p.errorf("unexpected %s, want a literal after %s", lit, op)
+	}
+	if lit.kind == tokName && name != "level" {
+		return nil, p.errorf("unexpected name %s, want a quoted string or a number after %s", lit.text, op)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if name == "level" && op != "=~" && op != "!~" {
+		level, err := parseLevelLiteral(lit)
+		if err != nil {
+			p.tok = lit
+			return nil, p.errorf("%v", err)
+		}
+		return levelNode{op: op, level: level}, nil
+	}
+
+	// levels matched by regular expressions are compared as text, like level =~ "warn|error"
+	node := valueNode{name: name, op: op, text: lit.text}
+	switch {
+	case op == "=~" || op == "!~":
+		re, err := regexp.Compile(lit.text)
+		if err != nil {
+			p.tok = lit
+			return nil, p.errorf("invalid regular expression: %v", err)
+		}
+		node.re = re
+	case lit.kind == tokNumber:
+		f, err := strconv.ParseFloat(lit.text, 64)
+		if err != nil {
+			p.tok = lit
+			return nil, p.errorf("invalid number %s", lit.text)
+		}
+		node.number, node.isNum = f, true
+	}
+	return node, nil
+}
+
+func parseLevelLiteral(lit token) (Level, error) {
+	if lit.kind == tokNumber {
+		n, err := strconv.Atoi(lit.text)
+		if err != nil || n < 0 || n > 255 {
+			return 0, fmt.Errorf("invalid level %s", lit.text)
+		}
+		return Level(n), nil
+	}
+	level, err := ParseLevel(lit.text)
+	if err != nil {
+		return 0, fmt.Errorf("unknown level %q", lit.text)
+	}
+	return level, nil
+}
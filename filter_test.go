@@ -0,0 +1,146 @@
+package log_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func TestFilter(t *testing.T) {
+	health := &log.Entry{Tag: "http", Level: log.Info, Message: "request", Fields: []interface{}{"path", "/healthz", "status", 200}}
+	failure := &log.Entry{Tag: "http", Level: log.Error, Message: "request failed", Fields: []interface{}{"path", "/users", "status", 503}}
+	cache := &log.Entry{Tag: "db", Level: log.Debug, Message: "cache miss", Fields: []interface{}{"ratio", 0.25}}
+
+	for _, tc := range []struct {
+		Expr string
+		Want [3]bool
+	}{
+		{`tag == "http" && path == "/healthz"`, [3]bool{true, false, false}},
+		{`tag != 'http'`, [3]bool{false, false, true}},
+		{`level < warn`, [3]bool{true, false, true}},
+		{`level >= "error"`, [3]bool{false, true, false}},
+		{`level == 30`, [3]bool{true, false, false}},
+		{`level =~ "^(debug|error)$"`, [3]bool{false, true, true}},
+		{`status >= 500`, [3]bool{false, true, false}},
+		{`status < 300 || ratio < 0.5`, [3]bool{true, false, true}},
+		{`msg =~ "^cache "`, [3]bool{false, false, true}},
+		{`msg !~ "request"`, [3]bool{false, false, true}},
+		{`!(tag == "http") && level <= debug`, [3]bool{false, false, true}},
+		{`missing != "x"`, [3]bool{true, true, true}},
+		{`missing == "x" || missing < 1`, [3]bool{false, false, false}},
+		{`path == "/users" && (status == 503 || status == 504)`, [3]bool{false, true, false}},
+		{`status == "503"`, [3]bool{false, true, false}},
+	} {
+		t.Run(tc.Expr, func(t *testing.T) {
+			f, err := log.CompileFilter(tc.Expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, entry := range []*log.Entry{health, failure, cache} {
+				if got := f.Match(entry); got != tc.Want[i] {
+					t.Errorf("invalid match for %s:\nwant: %v\ngot: %v", entry.Message, tc.Want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Expr string
+		Want string
+	}{
+		{``, `column 1: unexpected end of filter, want a name`},
+		{`tag`, `column 4: unexpected end of filter, want a comparison operator after tag`},
+		{`tag = "x"`, `column 5: unexpected character '='`},
+		{`tag == http`, `column 8: unexpected name http, want a quoted string or a number after ==`},
+		{`tag == "x" &&`, `column 14: unexpected end of filter, want a name`},
+		{`(tag == "x"`, `column 12: unexpected end of filter, want )`},
+		{`tag == "x" path == "y"`, `column 12: unexpected "path", want && or ||`},
+		{`level > loud`, `column 9: unknown level "loud"`},
+		{`msg =~ "("`, `column 8: invalid regular expression`},
+		{`msg == "open`, `column 8: unterminated string`},
+	} {
+		t.Run(tc.Expr, func(t *testing.T) {
+			_, err := log.CompileFilter(tc.Expr)
+			if err == nil || !strings.Contains(err.Error(), tc.Want) {
+				t.Errorf("invalid error:\nwant: %s\ngot: %v", tc.Want, err)
+			}
+		})
+	}
+}
+
+func TestDrop(t *testing.T) {
+	sink := &bytes.Buffer{}
+	e := log.New(log.WithOutput(sink), log.WithDrop(log.MustCompileFilter(`tag == "http" && path == "/healthz"`)))
+
+	logger := &log.Context{Emitter: e, Tag: "http"}
+	logger.C("path", "/healthz").I("request")
+	logger.I("request", "path", "/users")
+
+	want := `{"tag":"http","level":"info","msg":"request","path":"/users"}` + "\n"
+	if got := sink.String(); got != want {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+
+	if _, err := (&log.Config{Drop: `tag ==`}).New(); err == nil || !strings.Contains(err.Error(), "log: config drop: log: filter column 7") {
+		t.Errorf("invalid config error: %v", err)
+	}
+}
+
+func TestDropRedacted(t *testing.T) {
+	sink := &bytes.Buffer{}
+	e := log.New(log.WithOutput(sink), log.WithRedact("user"), log.WithDrop(log.MustCompileFilter(`user == "bot"`)))
+
+	(&log.Context{Emitter: e}).C("user", "bot").I("request")
+	e.I("", "request", "user", "bot")
+	e.I("", "request", "user", "alice")
+
+	want := `{"tag":"","level":"info","msg":"request","user":"[REDACTED]"}` + "\n"
+	if got := sink.String(); got != want {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+}
+
+func BenchmarkFilterSimple(b *testing.B) {
+	benchmarkFilter(b, `tag == "http"`)
+}
+
+func BenchmarkFilterFields(b *testing.B) {
+	benchmarkFilter(b, `tag == "http" && path == "/healthz" && status < 300`)
+}
+
+func BenchmarkFilterRegexp(b *testing.B) {
+	benchmarkFilter(b, `level < warn || msg =~ "^cache (hit|miss)"`)
+}
+
+func benchmarkFilter(b *testing.B, expr string) {
+	f := log.MustCompileFilter(expr)
+	entry := &log.Entry{
+		Tag:     "http",
+		Level:   log.Info,
+		Message: "request",
+		Fields:  []interface{}{"method", "GET", "path", "/healthz", "status", 200, "duration", 0.003},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Match(entry)
+	}
+	b.StopTimer()
+	b.ReportAllocs()
+}
+
+func BenchmarkEmitWithDrop(b *testing.B) {
+	e := log.New(log.WithOutput(ioutil.Discard), log.WithDrop(log.MustCompileFilter(`tag == "http" && path == "/healthz"`)))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.I("http", "request", "path", "/users", "status", 200)
+	}
+	b.StopTimer()
+	b.ReportAllocs()
+}
@@ -0,0 +1,616 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FluentMode is how entries are packed in Forward protocol messages
+type FluentMode byte
+
+const (
+	// FluentMessage sends every entry in its own message as soon as possible. This is the default.
+	FluentMessage FluentMode = iota
+
+	// FluentForward sends the entries in batches, one message per run of entries sharing a tag
+	FluentForward
+)
+
+// FluentOptions configures NewFluent
+type FluentOptions struct {
+	// Network is either tcp or unix, tcp when empty
+	Network string
+
+	// Address is the address of the Fluentd or Fluent Bit forward input, localhost:24224 when empty
+	Address string
+
+	// TagPrefix is prepended to the entry tags, with a dot, to make the Fluent tags.
+	// It is the tag of the untagged entries, which are tagged log when it is empty.
+	TagPrefix string
+
+	// Mode is how entries are packed in messages
+	Mode FluentMode
+
+	// RequireAck asks the server to acknowledge every message, which is sent again until it is
+	RequireAck bool
+
+	// BufferSize is how many entries are kept until they are sent, 1024 when zero.
+	// The oldest entries are dropped when the server is unreachable for too long.
+	BufferSize int
+
+	// BatchSize is how many entries are sent at once in the FluentForward mode, 256 when zero
+	BatchSize int
+
+	// FlushInterval is the longest time entries are kept before being sent,
+	// either batched or waiting for the server to come back, a second when zero
+	FlushInterval time.Duration
+
+	// Timeout limits dialing, writing and waiting for the acknowledgments, five seconds when zero
+	Timeout time.Duration
+
+	// OnError receives the errors sending the entries, which are written to os.Stderr
+	// at most once every ten seconds when nil
+	OnError func(err error)
+}
+
+// Fluent is an output sending the entries to Fluentd or Fluent Bit with the Forward protocol.
+//
+// Entries are sent as MessagePack records holding the level, the message and the fields,
+// with their time as an EventTime. They are buffered and sent by a background goroutine,
+// so a slow server and the acknowledgments do not stall the logging calls.
+// Entries failing to be sent are kept, up to BufferSize, and sent again once the connection
+// is dialed again, at most once a second.
+// Emitter.Sync and Emitter.Close, and so F, send the buffered entries.
+type Fluent struct {
+	options FluentOptions
+
+	// mu guards the buffer, a ring of records
+	mu      sync.Mutex
+	ring    []fluentRecord
+	head    int
+	count   int
+	first   uint64 // sequence number of the record at the head
+	closed  bool
+	dropped uint64
+
+	// sendMu guards the connection, held while sending
+	sendMu     sync.Mutex
+	conn       redialer
+	reader     *bufio.Reader
+	readerConn net.Conn
+	batch      []fluentRecord
+	msg        []byte
+	stats      writeStats
+
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type fluentRecord struct {
+	tag    string
+	time   time.Time
+	record []byte
+}
+
+// NewFluent connects to the forward input and starts the goroutine flushing the buffered entries
+func NewFluent(options FluentOptions) (*Fluent, error) {
+	if options.Network == "" {
+		options.Network = "tcp"
+	}
+	if options.Address == "" && options.Network == "tcp" {
+		options.Address = "localhost:24224"
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = 1024
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 256
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+
+	f := &Fluent{
+		options: options,
+		ring:    make([]fluentRecord, options.BufferSize),
+		notify:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	f.conn = redialer{
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(options.Network, options.Address, options.Timeout)
+		},
+		timeout: options.Timeout,
+	}
+	if err := f.conn.connect(); err != nil {
+		return nil, err
+	}
+
+	go f.run()
+	return f, nil
+}
+
+// WriteEntry implements EntryWriter, buffering the entry
+func (f *Fluent) WriteEntry(e *Emitter, entry *Entry) error {
+	record := make([]byte, 0, 128)
+	record = msgpackMapHeader(record, 2+len(e.fields)/2+len(entry.Fields)/2)
+	record = msgpackString(record, "level")
+	switch e.LevelFormat {
+	case LevelSeverity:
+		record = msgpackInt(record, int64(entry.Level.Severity()))
+	case LevelUpper:
+		record = msgpackString(record, upperLevel(entry.Level))
+	default:
+		record = msgpackString(record, entry.Level.String())
+	}
+	record = msgpackString(record, "msg")
+	record = msgpackString(record, entry.Message)
+	record = msgpackFields(record, e.fields)
+	record = msgpackFields(record, entry.Fields)
+
+	return f.push(fluentRecord{tag: f.tag(entry.Tag), time: entry.Time, record: record})
+}
+
+// Write implements io.Writer, sending the document as the log field of an untagged record
+func (f *Fluent) Write(p []byte) (int, error) {
+	record := msgpackMapHeader(nil, 1)
+	record = msgpackString(record, "log")
+	record = msgpackString(record, string(bytes.TrimRight(p, "\n")))
+	if err := f.push(fluentRecord{tag: f.tag(""), time: time.Now(), record: record}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the buffer and the connection are locked
+func (f *Fluent) Concurrent() bool {
+	return true
+}
+
+// Dropped returns how many entries were dropped because the buffer was full
+func (f *Fluent) Dropped() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
+
+// Sync sends the buffered entries
+func (f *Fluent) Sync() error {
+	return f.flush()
+}
+
+// Close sends the buffered entries, stops the background goroutine and closes the connection.
+// Entries written afterwards fail with ErrClosed.
+func (f *Fluent) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	f.mu.Unlock()
+
+	close(f.stop)
+	<-f.done
+
+	err := f.flush()
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+	if cerr := f.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *Fluent) tag(tag string) string {
+	switch {
+	case f.options.TagPrefix == "" && tag == "":
+		return "log"
+	case f.options.TagPrefix == "":
+		return tag
+	case tag == "":
+		return f.options.TagPrefix
+	default:
+		return f.options.TagPrefix + "." + tag
+	}
+}
+
+// push buffers the record, dropping the oldest one when the buffer is full,
+// and wakes the background goroutine up when the record should be sent
+func (f *Fluent) push(r fluentRecord) error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+
+	if f.count == len(f.ring) {
+		f.remove(1)
+		atomic.AddUint64(&f.dropped, 1)
+	}
+	f.ring[(f.head+f.count)%len(f.ring)] = r
+	f.count++
+	wake := f.options.Mode == FluentMessage || f.count >= f.options.BatchSize
+	f.mu.Unlock()
+
+	if wake {
+		select {
+		case f.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// remove removes n records from the head of the ring, the lock being held
+func (f *Fluent) remove(n int) {
+	for i := 0; i < n; i++ {
+		f.ring[(f.head+i)%len(f.ring)] = fluentRecord{}
+	}
+	f.head = (f.head + n) % len(f.ring)
+	f.count -= n
+	f.first += uint64(n)
+}
+
+func (f *Fluent) run() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.notify:
+			// the entries are kept until they are sent, so the error is only reported
+			f.flush()
+		case <-ticker.C:
+			f.flush()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// flush sends the buffered entries until the buffer is empty or sending fails.
+// The buffer is not locked while sending, so entries can be logged meanwhile.
+func (f *Fluent) flush() error {
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	for {
+		f.mu.Lock()
+		if f.count == 0 {
+			f.mu.Unlock()
+			return nil
+		}
+		seq := f.first
+		f.batch = append(f.batch[:0], f.ring[f.head])
+		if f.options.Mode == FluentForward {
+			for len(f.batch) < f.count && len(f.batch) < f.options.BatchSize {
+				r := f.ring[(f.head+len(f.batch))%len(f.ring)]
+				if r.tag != f.batch[0].tag {
+					break
+				}
+				f.batch = append(f.batch, r)
+			}
+		}
+		f.mu.Unlock()
+
+		err := f.send(f.batch)
+		n := len(f.batch)
+		for i := range f.batch {
+			f.batch[i] = fluentRecord{}
+		}
+		if err != nil {
+			f.conn.reset()
+			f.error(err)
+			return err
+		}
+
+		// the records sent may have been dropped meanwhile
+		f.mu.Lock()
+		if sent := seq + uint64(n); sent > f.first {
+			f.remove(int(sent - f.first))
+		}
+		f.mu.Unlock()
+	}
+}
+
+// send writes the records in a single message, waiting for the acknowledgment when required.
+// The connection lock is held.
+func (f *Fluent) send(records []fluentRecord) error {
+	var chunk string
+	if f.options.RequireAck {
+		var id [16]byte
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+
+	msg := f.msg[:0]
+	if f.options.Mode == FluentForward {
+		// [tag, [[time, record], ...], {size, chunk}]
+		msg = msgpackArrayHeader(msg, 3)
+		msg = msgpackString(msg, records[0].tag)
+		msg = msgpackArrayHeader(msg, len(records))
+		for _, r := range records {
+			msg = msgpackArrayHeader(msg, 2)
+			msg = msgpackEventTime(msg, r.time)
+			msg = append(msg, r.record...)
+		}
+		msg = f.option(msg, len(records), chunk)
+	} else {
+		// [tag, time, record, {chunk}]
+		r := records[0]
+		if chunk == "" {
+			msg = msgpackArrayHeader(msg, 3)
+		} else {
+			msg = msgpackArrayHeader(msg, 4)
+		}
+		msg = msgpackString(msg, r.tag)
+		msg = msgpackEventTime(msg, r.time)
+		msg = append(msg, r.record...)
+		if chunk != "" {
+			msg = f.option(msg, 0, chunk)
+		}
+	}
+	f.msg = msg
+
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	return f.readAck(chunk)
+}
+
+// option appends the option map of a message, with the size in the FluentForward mode
+func (f *Fluent) option(msg []byte, size int, chunk string) []byte {
+	fields := 0
+	if size > 0 {
+		fields++
+	}
+	if chunk != "" {
+		fields++
+	}
+	msg = msgpackMapHeader(msg, fields)
+	if size > 0 {
+		msg = msgpackString(msg, "size")
+		msg = msgpackInt(msg, int64(size))
+	}
+	if chunk != "" {
+		msg = msgpackString(msg, "chunk")
+		msg = msgpackString(msg, chunk)
+	}
+	return msg
+}
+
+// readAck waits for the {"ack": chunk} response
+func (f *Fluent) readAck(chunk string) error {
+	conn := f.conn.conn
+	if f.readerConn != conn {
+		f.reader, f.readerConn = bufio.NewReader(conn), conn
+	}
+	conn.SetReadDeadline(time.Now().Add(f.options.Timeout))
+
+	response, err := readMsgpackStringMap(f.reader)
+	if err != nil {
+		return fmt.Errorf("log: fluent: reading the acknowledgment: %v", err)
+	}
+	if response["ack"] != chunk {
+		return fmt.Errorf("log: fluent: invalid acknowledgment %q, want %q", response["ack"], chunk)
+	}
+	return nil
+}
+
+func (f *Fluent) error(err error) {
+	if f.options.OnError != nil {
+		f.options.OnError(err)
+		return
+	}
+	f.stats.report(err)
+}
+
+func msgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func msgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func msgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	default:
+		return appendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func msgpackUint(b []byte, u uint64) []byte {
+	if u < 128 {
+		return append(b, byte(u))
+	}
+	return appendUint64(append(b, 0xcf), u)
+}
+
+func msgpackFloat(b []byte, f float64) []byte {
+	return appendUint64(append(b, 0xcb), math.Float64bits(f))
+}
+
+// msgpackEventTime appends the time as the Forward protocol EventTime extension
+func msgpackEventTime(b []byte, t time.Time) []byte {
+	sec, nsec := uint32(t.Unix()), uint32(t.Nanosecond())
+	return append(b, 0xd7, 0x00,
+		byte(sec>>24), byte(sec>>16), byte(sec>>8), byte(sec),
+		byte(nsec>>24), byte(nsec>>16), byte(nsec>>8), byte(nsec))
+}
+
+func appendUint64(b []byte, u uint64) []byte {
+	return append(b, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32), byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+// msgpackFields appends the fields as map entries, the values rendered like the JSON encoder does
+func msgpackFields(b []byte, fields []interface{}) []byte {
+	for i := 0; i+1 < len(fields); i += 2 {
+		b = msgpackString(b, keyString(fields[i]))
+		switch val := fields[i+1].(type) {
+		case nil:
+			b = append(b, 0xc0)
+		case bool:
+			if val {
+				b = append(b, 0xc3)
+			} else {
+				b = append(b, 0xc2)
+			}
+		case int:
+			b = msgpackInt(b, int64(val))
+		case int8:
+			b = msgpackInt(b, int64(val))
+		case int16:
+			b = msgpackInt(b, int64(val))
+		case int32:
+			b = msgpackInt(b, int64(val))
+		case int64:
+			b = msgpackInt(b, val)
+		case uint:
+			b = msgpackUint(b, uint64(val))
+		case uint8:
+			b = msgpackUint(b, uint64(val))
+		case uint16:
+			b = msgpackUint(b, uint64(val))
+		case uint32:
+			b = msgpackUint(b, uint64(val))
+		case uint64:
+			b = msgpackUint(b, val)
+		case float32:
+			b = msgpackFloat(b, float64(val))
+		case float64:
+			b = msgpackFloat(b, val)
+		default:
+			b = msgpackString(b, valueString(val))
+		}
+	}
+	return b
+}
+
+// readMsgpackStringMap reads a map of strings, like the acknowledgments
+func readMsgpackStringMap(r *bufio.Reader) (map[string]string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch {
+	case c&0xf0 == 0x80:
+		n = int(c & 0x0f)
+	case c == 0xde:
+		n, err = readMsgpackSize(r, 2)
+	case c == 0xdf:
+		n, err = readMsgpackSize(r, 4)
+	default:
+		return nil, fmt.Errorf("not a map: 0x%02x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		if m[key], err = readMsgpackString(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func readMsgpackString(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = readMsgpackSize(r, 1)
+	case c == 0xda, c == 0xc5:
+		n, err = readMsgpackSize(r, 2)
+	case c == 0xdb, c == 0xc6:
+		n, err = readMsgpackSize(r, 4)
+	default:
+		return "", errors.New("not a string")
+	}
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func readMsgpackSize(r *bufio.Reader, size int) (int, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:size]); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, c := range b[:size] {
+		n = n<<8 | int(c)
+	}
+	return n, nil
+}
@@ -0,0 +1,309 @@
+package log_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// decodeMsgpack decodes the MessagePack types the Fluent output sends, EventTimes as time.Time
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if _, rerr := io.ReadFull(r, b); rerr != nil {
+			err = rerr
+		}
+		return b
+	}
+	size := func(n int) int {
+		v := 0
+		for _, c := range read(n) {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	collection := func(n int, isMap bool) interface{} {
+		if isMap {
+			m := map[string]interface{}{}
+			for i := 0; i < n && err == nil; i++ {
+				var k, v interface{}
+				if k, err = decodeMsgpack(r); err == nil {
+					v, err = decodeMsgpack(r)
+					m[fmt.Sprint(k)] = v
+				}
+			}
+			return m
+		}
+		a := make([]interface{}, n)
+		for i := 0; i < n && err == nil; i++ {
+			a[i], err = decodeMsgpack(r)
+		}
+		return a
+	}
+
+	var v interface{}
+	switch {
+	case c < 0x80:
+		v = int64(c)
+	case c >= 0xe0:
+		v = int64(int8(c))
+	case c&0xf0 == 0x80:
+		v = collection(int(c&0x0f), true)
+	case c&0xf0 == 0x90:
+		v = collection(int(c&0x0f), false)
+	case c&0xe0 == 0xa0:
+		v = string(read(int(c & 0x1f)))
+	case c == 0xc0:
+		v = nil
+	case c == 0xc2, c == 0xc3:
+		v = c == 0xc3
+	case c == 0xcb:
+		v = math.Float64frombits(binary.BigEndian.Uint64(read(8)))
+	case c == 0xcf:
+		v = binary.BigEndian.Uint64(read(8))
+	case c == 0xd3:
+		v = int64(binary.BigEndian.Uint64(read(8)))
+	case c == 0xd7:
+		b := read(9)
+		v = time.Unix(int64(binary.BigEndian.Uint32(b[1:5])), int64(binary.BigEndian.Uint32(b[5:])))
+	case c == 0xd9:
+		v = string(read(size(1)))
+	case c == 0xda:
+		v = string(read(size(2)))
+	case c == 0xdb:
+		v = string(read(size(4)))
+	case c == 0xdc:
+		v = collection(size(2), false)
+	case c == 0xde:
+		v = collection(size(2), true)
+	default:
+		return nil, fmt.Errorf("unexpected type 0x%02x", c)
+	}
+	return v, err
+}
+
+// fluentServer accepts connections and decodes the messages, acknowledging them when asked
+type fluentServer struct {
+	ln       net.Listener
+	messages chan []interface{}
+	ack      bool
+}
+
+func newFluentServer(t *testing.T, ack bool) *fluentServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fluentServer{ln: ln, messages: make(chan []interface{}, 16), ack: ack}
+	go s.serve()
+	return s
+}
+
+func (s *fluentServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fluentServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := decodeMsgpack(r)
+		if err != nil {
+			return
+		}
+		msg := v.([]interface{})
+		if s.ack {
+			chunk := msg[len(msg)-1].(map[string]interface{})["chunk"].(string)
+			conn.Write(append([]byte{0x81, 0xa3, 'a', 'c', 'k', 0xa0 | byte(len(chunk))}, chunk...))
+		}
+		s.messages <- msg
+	}
+}
+
+func (s *fluentServer) receive(t *testing.T) []interface{} {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+func TestFluentMessage(t *testing.T) {
+	server := newFluentServer(t, true)
+	defer server.ln.Close()
+
+	out, err := log.NewFluent(log.FluentOptions{Address: server.ln.Addr().String(), TagPrefix: "app", RequireAck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := log.New(log.WithOutput(out), log.WithFields("request", "abc"))
+	e.W("http", "slow request", "duration", 1.5, "status", 200, "retried", true)
+
+	msg := server.receive(t)
+	if len(msg) != 4 || msg[0] != "app.http" {
+		t.Fatalf("invalid message: %v", msg)
+	}
+	if tm, ok := msg[1].(time.Time); !ok || time.Since(tm) > time.Minute {
+		t.Errorf("invalid time: %v", msg[1])
+	}
+	record := msg[2].(map[string]interface{})
+	want := map[string]interface{}{
+		"level": "warn", "msg": "slow request", "request": "abc", "duration": 1.5, "status": int64(200), "retried": true,
+	}
+	if fmt.Sprint(record) != fmt.Sprint(want) {
+		t.Errorf("invalid record:\nwant: %v\ngot: %v", want, record)
+	}
+
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := out.Write([]byte("late\n")); err != log.ErrClosed {
+		t.Errorf("invalid error after close: %v", err)
+	}
+}
+
+func TestFluentForward(t *testing.T) {
+	server := newFluentServer(t, false)
+	defer server.ln.Close()
+
+	out, err := log.NewFluent(log.FluentOptions{
+		Address:       server.ln.Addr().String(),
+		Mode:          log.FluentForward,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := log.New(log.WithOutput(out))
+	e.I("db", "one")
+	e.I("db", "two")
+	e.I("http", "three")
+
+	// entries are batched until synced
+	select {
+	case msg := <-server.messages:
+		t.Fatalf("entries were sent before the flush: %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := server.receive(t)
+	entries := msg[1].([]interface{})
+	if msg[0] != "db" || len(entries) != 2 || msg[2].(map[string]interface{})["size"] != int64(2) {
+		t.Fatalf("invalid message: %v", msg)
+	}
+	if record := entries[1].([]interface{})[1].(map[string]interface{}); record["msg"] != "two" {
+		t.Errorf("invalid record: %v", record)
+	}
+	if msg := server.receive(t); msg[0] != "http" || len(msg[1].([]interface{})) != 1 {
+		t.Errorf("invalid message: %v", msg)
+	}
+}
+
+func TestFluentRetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	var failures int32
+	out, err := log.NewFluent(log.FluentOptions{
+		Address:       addr,
+		BufferSize:    2,
+		FlushInterval: time.Hour,
+		OnError:       func(err error) { atomic.AddInt32(&failures, 1) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out))
+
+	// the server goes away, which the output notices after a few writes
+	conn, _ := ln.Accept()
+	conn.Close()
+	ln.Close()
+	for i := 0; atomic.LoadInt32(&failures) == 0; i++ {
+		if i == 1000 {
+			t.Fatal("the connection never failed")
+		}
+		e.I("test", "probe")
+		time.Sleep(time.Millisecond)
+	}
+
+	// so the entries are buffered, and the oldest ones dropped
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		e.I("test", msg)
+	}
+	if out.Dropped() < 2 {
+		t.Fatalf("entries were not dropped: %d", out.Dropped())
+	}
+
+	// the server comes back
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fluentServer{ln: ln, messages: make(chan []interface{}, 16)}
+	go server.serve()
+	defer ln.Close()
+
+	waitFor(t, "the buffered entries", func() bool { return e.Sync() == nil })
+	for _, want := range []string{"three", "four"} {
+		msg := server.receive(t)
+		if got := msg[2].(map[string]interface{})["msg"]; got != want {
+			t.Errorf("invalid message: want %s, got %v", want, got)
+		}
+	}
+}
+
+func TestFluentSlowAck(t *testing.T) {
+	// the server never acknowledges, so every message waits for the timeout
+	server := newFluentServer(t, false)
+	defer server.ln.Close()
+
+	out, err := log.NewFluent(log.FluentOptions{
+		Address:    server.ln.Addr().String(),
+		RequireAck: true,
+		Timeout:    200 * time.Millisecond,
+		OnError:    func(err error) {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out))
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		e.I("test", "entry")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("logging waited for the acknowledgments: %v", elapsed)
+	}
+	server.receive(t)
+}
@@ -0,0 +1,281 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GELFEncoder renders entries as GELF 1.1 documents, one per line, for Graylog.
+//
+// The tag and the fields are sent as additional fields, prefixed by an underscore, with the characters
+// other than letters, digits, underscores, dashes and dots replaced by underscores. Graylog stores
+// them without the underscore, so the fields named like the reserved id field, the header fields
+// or the tag get an underscore suffix, like _id_ and _level_.
+// Numbers are kept and other values are sent as strings, as GELF requires.
+// The level is sent as a syslog severity, see Syslog.
+type GELFEncoder struct {
+	// Host identifies the machine, os.Hostname when empty
+	Host string
+}
+
+// Encode implements Encoder
+func (g GELFEncoder) Encode(buf *bytes.Buffer, e *Emitter, entry *Entry) {
+	host := g.Host
+	if host == "" {
+		host = localHostname()
+	}
+
+	buf.WriteString(`{"version":"1.1","host":`)
+	writeJSONString(buf, host)
+	buf.WriteString(`,"short_message":`)
+	writeJSONString(buf, entry.Message)
+	buf.WriteString(`,"timestamp":`)
+	buf.WriteString(strconv.FormatFloat(float64(entry.Time.UnixNano()/int64(time.Millisecond))/1000, 'f', 3, 64))
+	buf.WriteString(`,"level":`)
+	buf.WriteString(strconv.Itoa(entry.Level.Severity()))
+	if entry.Tag != "" {
+		buf.WriteString(`,"_tag":`)
+		writeJSONString(buf, entry.Tag)
+	}
+	writeGELFFields(buf, e.fields)
+	writeGELFFields(buf, entry.Fields)
+	buf.WriteString("}\n")
+}
+
+// gelfReserved are the names the additional fields cannot take: the reserved id,
+// the header fields, the fields Graylog sets and the tag
+var gelfReserved = map[string]bool{
+	"id": true, "version": true, "host": true, "short_message": true, "full_message": true,
+	"timestamp": true, "level": true, "facility": true, "line": true, "file": true,
+	"message": true, "source": true, "tag": true,
+}
+
+func writeGELFFields(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i+1 < len(fields); i += 2 {
+		buf.WriteString(`,"_`)
+		name := []byte(keyString(fields[i]))
+		for j, c := range name {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+				name[j] = '_'
+			}
+		}
+		buf.Write(name)
+		if gelfReserved[string(name)] {
+			buf.WriteByte('_')
+		}
+		buf.WriteString(`":`)
+
+		switch val := fields[i+1].(type) {
+		case byte, int, int8, int16, int32, int64, float32, float64, uint, uint16, uint32, uint64:
+			fmt.Fprintf(buf, `%v`, val)
+		default:
+			writeJSONString(buf, valueString(val))
+		}
+	}
+}
+
+var (
+	hostnameOnce sync.Once
+	hostname     string
+)
+
+func localHostname() string {
+	hostnameOnce.Do(func() {
+		hostname, _ = os.Hostname()
+	})
+	return hostname
+}
+
+// GELFCompression is the compression of the GELF messages sent over UDP
+type GELFCompression byte
+
+const (
+	// GELFUncompressed sends the messages as they are. This is the default.
+	GELFUncompressed GELFCompression = iota
+
+	// GELFGzip compresses the messages with gzip
+	GELFGzip
+
+	// GELFZlib compresses the messages with zlib
+	GELFZlib
+)
+
+// gelfMaxChunks is the most chunks a GELF message may be split into
+const gelfMaxChunks = 128
+
+// GELFOptions configures NewGELF
+type GELFOptions struct {
+	// Network is either udp or tcp, udp when empty
+	Network string
+
+	// Address is the address of the Graylog input, like graylog:12201
+	Address string
+
+	// Compression compresses the messages sent over UDP. TCP inputs do not support compression.
+	Compression GELFCompression
+
+	// ChunkSize is the largest datagram sent over UDP, 1420 bytes when zero.
+	// Larger messages are split in up to 128 chunks.
+	ChunkSize int
+
+	// Timeout limits dialing and writing, five seconds when zero
+	Timeout time.Duration
+
+	// Host identifies the machine, os.Hostname when empty
+	Host string
+}
+
+// GELF is an output sending the entries to Graylog, encoded by a GELFEncoder.
+//
+// Messages are sent in chunked datagrams over UDP, and null byte terminated over TCP.
+// The connection is dialed again when writing fails, at most once a second.
+type GELF struct {
+	options GELFOptions
+	encoder GELFEncoder
+
+	mu         sync.Mutex
+	conn       redialer
+	buf        bytes.Buffer
+	compressed bytes.Buffer
+	chunk      []byte
+	id         uint64
+}
+
+// NewGELF connects to the Graylog input
+func NewGELF(options GELFOptions) (*GELF, error) {
+	if options.Network == "" {
+		options.Network = "udp"
+	}
+	if options.ChunkSize <= 12 {
+		options.ChunkSize = 1420
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+
+	g := &GELF{
+		options: options,
+		encoder: GELFEncoder{Host: options.Host},
+		chunk:   make([]byte, options.ChunkSize),
+		id:      rand.Uint64(),
+	}
+	g.conn = redialer{
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(options.Network, options.Address, options.Timeout)
+		},
+		timeout: options.Timeout,
+	}
+	if err := g.conn.connect(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// WriteEntry implements EntryWriter
+func (g *GELF) WriteEntry(e *Emitter, entry *Entry) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.buf.Reset()
+	g.encoder.Encode(&g.buf, e, entry)
+	g.buf.Truncate(g.buf.Len() - 1)
+	return g.send(g.buf.Bytes())
+}
+
+// Write implements io.Writer, sending the document as it is, which must be a GELF message
+func (g *GELF) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.buf.Reset()
+	g.buf.Write(bytes.TrimRight(p, "\n"))
+	if err := g.send(g.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the connection is locked
+func (g *GELF) Concurrent() bool {
+	return true
+}
+
+// Close closes the connection
+func (g *GELF) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.conn.Close()
+}
+
+func (g *GELF) send(msg []byte) error {
+	if g.options.Network == "tcp" || g.options.Network == "tcp4" || g.options.Network == "tcp6" {
+		_, err := g.conn.Write(append(msg, 0))
+		return err
+	}
+
+	if g.options.Compression != GELFUncompressed {
+		var err error
+		if msg, err = g.compress(msg); err != nil {
+			return err
+		}
+	}
+	if len(msg) <= g.options.ChunkSize {
+		_, err := g.conn.Write(msg)
+		return err
+	}
+	return g.sendChunks(msg)
+}
+
+func (g *GELF) compress(msg []byte) ([]byte, error) {
+	g.compressed.Reset()
+	var w io.WriteCloser
+	if g.options.Compression == GELFGzip {
+		w = gzip.NewWriter(&g.compressed)
+	} else {
+		w = zlib.NewWriter(&g.compressed)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return g.compressed.Bytes(), nil
+}
+
+// sendChunks splits the message in chunks sharing a message id, each with a 12 bytes header
+func (g *GELF) sendChunks(msg []byte) error {
+	size := g.options.ChunkSize - 12
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("log: gelf: message too large, %d bytes", len(msg))
+	}
+
+	g.id++
+	for seq := 0; seq < count; seq++ {
+		part := msg[seq*size:]
+		if len(part) > size {
+			part = part[:size]
+		}
+
+		chunk := g.chunk[:12]
+		chunk[0], chunk[1] = 0x1e, 0x0f
+		binary.BigEndian.PutUint64(chunk[2:10], g.id)
+		chunk[10], chunk[11] = byte(seq), byte(count)
+		chunk = append(chunk, part...)
+		if _, err := g.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func TestGELFEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := log.New(log.WithOutput(&buf), log.WithEncoder(log.GELFEncoder{Host: "host"}), log.WithFields("id", 7))
+	e.W("http", "slow request", "duration ms", 1.5, "path", "/users", "retried", true,
+		"tag", "v2", "level", "high", "short_message", "none")
+
+	want := `{"version":"1.1","host":"host","short_message":"slow request","timestamp":` +
+		`\d+\.\d{3},"level":4,"_tag":"http","_id_":7,"_duration_ms":1.5,"_path":"/users","_retried":"true",` +
+		`"_tag_":"v2","_level_":"high","_short_message_":"none"}` + "\n"
+	got := buf.String()
+	if !matchTimestamp(want, got) {
+		t.Errorf("invalid document:\nwant: %s\ngot: %s", want, got)
+	}
+}
+
+// matchTimestamp compares the documents, skipping the timestamp
+func matchTimestamp(want, got string) bool {
+	i := strings.Index(want, `\d+`)
+	j := strings.Index(got[i:], ",")
+	if i < 0 || j < 0 || want[:i] != got[:i] {
+		return false
+	}
+	return want[i+len(`\d+\.\d{3}`):] == got[i+j:]
+}
+
+func TestGELFUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65536)
+	receive := func() []byte {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), buf[:n]...)
+	}
+
+	tests := []struct {
+		name        string
+		compression log.GELFCompression
+		decompress  func(io.Reader) (io.Reader, error)
+	}{
+		{"Uncompressed", log.GELFUncompressed, func(r io.Reader) (io.Reader, error) { return r, nil }},
+		{"Gzip", log.GELFGzip, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"Zlib", log.GELFZlib, func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := log.NewGELF(log.GELFOptions{
+				Address:     conn.LocalAddr().String(),
+				Compression: test.compression,
+				ChunkSize:   512,
+				Host:        "host",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer out.Close()
+			e := log.New(log.WithOutput(out))
+
+			// varied text compresses poorly, so the message is chunked either way
+			var large bytes.Buffer
+			for i := 0; large.Len() < 4096; i++ {
+				large.WriteString(strings.Repeat(string(rune('a'+i*7%26)), i%5+1))
+				large.WriteString(time.Duration(i * 7919).String())
+			}
+
+			for _, msg := range []string{"small", large.String()} {
+				e.I("test", msg)
+
+				// reassemble the chunks in order
+				payload := receive()
+				if payload[0] == 0x1e && payload[1] == 0x0f {
+					id, count := payload[2:10], int(payload[11])
+					chunks := make([][]byte, count)
+					for i := 0; i < count; i++ {
+						if i > 0 {
+							payload = receive()
+						}
+						if len(payload) > 512 || !bytes.Equal(payload[2:10], id) {
+							t.Fatalf("invalid chunk: %d bytes, id %x", len(payload), payload[2:10])
+						}
+						chunks[payload[10]] = payload[12:]
+					}
+					payload = bytes.Join(chunks, nil)
+				} else if len(msg) > 512 {
+					t.Fatal("large message was not chunked")
+				}
+
+				r, err := test.decompress(bytes.NewReader(payload))
+				if err != nil {
+					t.Fatal(err)
+				}
+				doc, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got struct {
+					Version string `json:"version"`
+					Message string `json:"short_message"`
+					Level   int    `json:"level"`
+					Tag     string `json:"_tag"`
+				}
+				if err := json.Unmarshal(doc, &got); err != nil {
+					t.Fatalf("invalid document %q: %v", doc, err)
+				}
+				if got.Version != "1.1" || got.Message != msg || got.Level != 6 || got.Tag != "test" {
+					t.Errorf("invalid document: %+v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	out, err := log.NewGELF(log.GELFOptions{Network: "tcp", Address: ln.Addr().String(), Host: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out))
+
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	e.I("test", "one")
+	e.E("test", "two\nlines")
+
+	r := bufio.NewReader(server)
+	for _, want := range []string{`"short_message":"one"`, `"short_message":"two\nlines"`} {
+		doc, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(doc, []byte(want)) || bytes.IndexByte(doc, '\n') >= 0 {
+			t.Errorf("invalid document: %q", doc)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrDrop vetoes an entry when returned by an EntryHook
+var ErrDrop = errors.New("log: entry dropped")
+
+// EntryHook is called with every entry before it is encoded.
+//
+// Hooks may change the message, add fields with Entry.Add, or drop the entry by returning ErrDrop.
+// Any other error is reported to the emitter OnHookError, and the entry is emitted anyway.
+// The entry is reused once Emit returns, so hooks keeping it must keep a Clone instead.
+type EntryHook interface {
+	Fire(entry *Entry) error
+}
+
+// EntryHookFunc adapts a function to the EntryHook interface
+type EntryHookFunc func(entry *Entry) error
+
+// Fire implements EntryHook
+func (f EntryHookFunc) Fire(entry *Entry) error {
+	return f(entry)
+}
+
+// CopyHook wraps a hook so it receives its own copy of every document, which it may keep
+func CopyHook(hook Hook) Hook {
+	return func(level Level, doc []byte) {
+		owned := make([]byte, len(doc))
+		copy(owned, doc)
+		hook(level, owned)
+	}
+}
+
+// LevelHook wraps a hook so it is only called with entries at the given level or above
+func LevelHook(min Level, hook Hook) Hook {
+	return func(level Level, doc []byte) {
+		if level >= min {
+			hook(level, doc)
+		}
+	}
+}
+
+// LevelEntryHook wraps an entry hook so it is only called with entries at the given level or above
+func LevelEntryHook(min Level, hook EntryHook) EntryHook {
+	return levelEntryHook{min: min, EntryHook: hook}
+}
+
+type levelEntryHook struct {
+	EntryHook
+	min Level
+}
+
+func (h levelEntryHook) Fire(entry *Entry) error {
+	if entry.Level < h.min {
+		return nil
+	}
+	return h.EntryHook.Fire(entry)
+}
+
+// Sync flushes the wrapped hook, see Emitter.Sync
+func (h levelEntryHook) Sync() error {
+	return syncValue(h.EntryHook)
+}
+
+// Close closes the wrapped hook, see Emitter.Close
+func (h levelEntryHook) Close() error {
+	return closeValue(h.EntryHook)
+}
+
+// fireHooks calls every hook in order, telling whether the entry should be emitted
+func (e *Emitter) fireHooks(entry *Entry) bool {
+	for _, hook := range e.Hooks {
+		err := fireHook(hook, entry)
+		if err == ErrDrop {
+			return false
+		}
+		if err != nil {
+			e.hookError(err)
+		}
+	}
+	return true
+}
+
+// fireHook turns a panicking hook into an error, so it does not break logging
+func fireHook(hook EntryHook, entry *Entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("log: hook panic: %v", r)
+		}
+	}()
+	return hook.Fire(entry)
+}
+
+func (e *Emitter) hookError(err error) {
+	if e.OnHookError != nil {
+		e.OnHookError(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "log: hook error: %v\n", err)
+}
@@ -0,0 +1,152 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func TestEntryHooks(t *testing.T) {
+	sink := &bytes.Buffer{}
+	var hookErrors []string
+
+	var seen []interface{}
+	e := log.New(
+		log.WithOutput(sink),
+		log.WithFields("app", "test"),
+		log.WithEntryHook(log.EntryHookFunc(func(entry *log.Entry) error {
+			if entry.Tag == "noise" {
+				return log.ErrDrop
+			}
+			app, _ := entry.Get("app")
+			seen = append(seen, app)
+			entry.Message = strings.ToUpper(entry.Message)
+			entry.Add("hooked", true)
+			return nil
+		})),
+		log.WithEntryHook(log.EntryHookFunc(func(entry *log.Entry) error {
+			if id, ok := entry.Get("id"); ok && id == 2 {
+				return errors.New("bad id")
+			}
+			return nil
+		})),
+		log.WithEntryHook(log.EntryHookFunc(func(entry *log.Entry) error {
+			if id, ok := entry.Get("id"); ok && id == 3 {
+				panic("broken hook")
+			}
+			return nil
+		})),
+	)
+	e.OnHookError = func(err error) { hookErrors = append(hookErrors, err.Error()) }
+
+	fields := make([]interface{}, 2, 10)
+	fields[0], fields[1] = "id", 1
+	e.I("tag", "one", fields...)
+	e.I("noise", "dropped")
+	e.I("tag", "two", "id", 2)
+	e.I("tag", "three", "id", 3)
+
+	want := `{"tag":"tag","level":"info","msg":"ONE","app":"test","id":1,"hooked":true}` + "\n" +
+		`{"tag":"tag","level":"info","msg":"TWO","app":"test","id":2,"hooked":true}` + "\n" +
+		`{"tag":"tag","level":"info","msg":"THREE","app":"test","id":3,"hooked":true}` + "\n"
+	if got := sink.String(); got != want {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+	if got := fields[:3][2]; got != nil {
+		t.Errorf("hook changed the caller fields: %v", got)
+	}
+	if len(seen) != 3 || seen[0] != "test" {
+		t.Errorf("hook did not see the context fields: %v", seen)
+	}
+	if want := "bad id|log: hook panic: broken hook"; strings.Join(hookErrors, "|") != want {
+		t.Errorf("invalid hook errors:\nwant: %s\ngot: %s", want, strings.Join(hookErrors, "|"))
+	}
+}
+
+func TestRetainedHooks(t *testing.T) {
+	const goroutines, entries = 8, 200
+
+	docs := make(chan []byte, goroutines*entries)
+	var clones []*log.Entry
+	var clonesMu sync.Mutex
+
+	e := log.New(
+		log.WithOutput(ioutil.Discard),
+		log.WithHook(log.CopyHook(func(l log.Level, doc []byte) { docs <- doc })),
+		log.WithEntryHook(log.EntryHookFunc(func(entry *log.Entry) error {
+			clonesMu.Lock()
+			clones = append(clones, entry.Clone())
+			clonesMu.Unlock()
+			return nil
+		})),
+	)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			fields := make([]interface{}, 2)
+			for i := 0; i < entries; i++ {
+				id := fmt.Sprintf("%d-%d", g, i)
+				fields[0], fields[1] = "id", id
+				e.I("test", id, fields...)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(docs)
+
+	count := 0
+	for doc := range docs {
+		var got struct{ Msg, ID string }
+		if err := json.Unmarshal(doc, &got); err != nil {
+			t.Fatalf("corrupted document: %s", doc)
+		}
+		if got.Msg != got.ID {
+			t.Fatalf("corrupted document: %s", doc)
+		}
+		count++
+	}
+	if count != goroutines*entries {
+		t.Errorf("invalid documents count:\nwant: %d\ngot: %d", goroutines*entries, count)
+	}
+
+	for _, clone := range clones {
+		if id, _ := clone.Get("id"); id != clone.Message {
+			t.Fatalf("corrupted entry: %s %v", clone.Message, clone.Fields)
+		}
+	}
+}
+
+func TestLevelHooks(t *testing.T) {
+	var docs, entries []log.Level
+	e := log.New(
+		log.WithOutput(ioutil.Discard),
+		log.WithLevel(log.Trace),
+		log.WithHook(log.LevelHook(log.Error, func(l log.Level, doc []byte) { docs = append(docs, l) })),
+		log.WithEntryHook(log.LevelEntryHook(log.Warn, log.EntryHookFunc(func(entry *log.Entry) error {
+			entries = append(entries, entry.Level)
+			return nil
+		}))),
+	)
+
+	for _, level := range []log.Level{log.Trace, log.Info, log.Warn, log.Error, log.Panic} {
+		e.Emit("test", level, "hello")
+	}
+
+	if !reflect.DeepEqual(docs, []log.Level{log.Error, log.Panic}) {
+		t.Errorf("invalid hooked levels: %v", docs)
+	}
+	if !reflect.DeepEqual(entries, []log.Level{log.Warn, log.Error, log.Panic}) {
+		t.Errorf("invalid hooked entry levels: %v", entries)
+	}
+}
@@ -0,0 +1,701 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPFormat is the body of the requests sent by an HTTPOutput
+type HTTPFormat byte
+
+const (
+	// HTTPNDJSON posts the entries encoded by the emitter encoder, one per line. This is the default.
+	HTTPNDJSON HTTPFormat = iota
+
+	// HTTPLoki posts the entries to the Loki push API, with the labels from the tag and LokiLabels.
+	// The entries encoded by the emitter encoder are the log lines.
+	HTTPLoki
+
+	// HTTPElasticsearch posts the entries to the Elasticsearch bulk API, indexing them in Index.
+	// The entries are encoded as JSON documents, with their time as @timestamp.
+	// The documents failing with a 429 or a 5xx status are sent again, and the others are reported.
+	HTTPElasticsearch
+)
+
+// HTTPOptions configures NewHTTPOutput
+type HTTPOptions struct {
+	// URL is where the batches are posted, like http://loki:3100/loki/api/v1/push or http://es:9200/_bulk
+	URL string
+
+	// Format is the body of the requests
+	Format HTTPFormat
+
+	// Header is added to every request, for instance to authenticate
+	Header http.Header
+
+	// Client sends the requests, a client with a ten seconds timeout when nil
+	Client *http.Client
+
+	// Gzip compresses the request bodies
+	Gzip bool
+
+	// BatchCount is the most entries sent in a request, 1000 when zero
+	BatchCount int
+
+	// BatchBytes is the size of the encoded entries filling a request, 1 MiB when zero
+	BatchBytes int
+
+	// FlushInterval is the longest time an entry waits to be sent, a second when zero
+	FlushInterval time.Duration
+
+	// MaxInFlight is how many requests are sent at the same time, 2 when zero
+	MaxInFlight int
+
+	// QueueSize is how many batches wait to be sent, 8 when zero
+	QueueSize int
+
+	// Overflow tells what happens to a batch when the queue is full
+	Overflow OverflowPolicy
+
+	// MaxRetries is how many times a request failing with a network error, a 429 or a 5xx status
+	// is sent again, 5 when zero and none when negative
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between the retries,
+	// which waits a random duration up to the bound, 100ms and 10s when zero
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// LokiLabels are the fields sent as labels in the HTTPLoki format, along with the tag.
+	// The level is sent as a label when listed.
+	LokiLabels []string
+
+	// Index is the index of the documents in the HTTPElasticsearch format
+	Index string
+
+	// OnError receives the errors sending the batches, which are written to os.Stderr
+	// at most once every ten seconds when nil
+	OnError func(err error)
+}
+
+// HTTPOutput is an output posting the entries in batches to an HTTP endpoint,
+// like Loki, Elasticsearch or any service ingesting NDJSON.
+//
+// Batches are sent when they reach BatchCount entries or BatchBytes, or once FlushInterval elapses,
+// by up to MaxInFlight requests at once. Failing requests are retried with an exponential backoff.
+// Emitter.Sync and Emitter.Close, and so F, send the pending batches.
+type HTTPOutput struct {
+	// first, so the counters are aligned for atomic operations on 32 bit platforms
+	dropped uint64
+	stats   writeStats
+
+	options HTTPOptions
+	format  httpFormat
+
+	mu     sync.Mutex
+	batch  []httpEntry
+	size   int
+	closed bool
+
+	idle    *sync.Cond
+	pending int
+
+	queue   chan []httpEntry
+	senders sync.WaitGroup
+	stop    chan struct{}
+	done    chan struct{}
+	workers sync.WaitGroup
+}
+
+// httpEntry is an entry kept in a batch
+type httpEntry struct {
+	time time.Time
+
+	// stream groups the entries in the formats sending streams
+	stream string
+
+	// doc is the entry rendered by the format
+	doc []byte
+}
+
+// httpFormat renders the batches as request bodies
+type httpFormat interface {
+	contentType() string
+	encode(e *Emitter, entry *Entry) []byte
+	raw(p []byte) []byte
+	body(buf *bytes.Buffer, batch []httpEntry)
+}
+
+// httpStreamFormat is implemented by the formats grouping the entries in streams
+type httpStreamFormat interface {
+	stream(tag string, level Level, context, fields []interface{}) string
+}
+
+// httpBulkFormat is implemented by the formats whose responses report the result of every entry
+type httpBulkFormat interface {
+	// results returns the entries to send again and the error of the entries rejected
+	results(response []byte, batch []httpEntry) (retry []httpEntry, rejected int, err error)
+}
+
+// NewHTTPOutput starts the goroutines sending the batches
+func NewHTTPOutput(options HTTPOptions) *HTTPOutput {
+	var format httpFormat
+	switch options.Format {
+	case HTTPLoki:
+		format = lokiFormat{labels: options.LokiLabels}
+	case HTTPElasticsearch:
+		format = elasticsearchFormat{index: options.Index}
+	default:
+		format = ndjsonFormat{}
+	}
+	return newHTTPOutput(options, format)
+}
+
+func newHTTPOutput(options HTTPOptions, format httpFormat) *HTTPOutput {
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.BatchCount <= 0 {
+		options.BatchCount = 1000
+	}
+	if options.BatchBytes <= 0 {
+		options.BatchBytes = 1 << 20
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = 2
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 8
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = 5
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = 100 * time.Millisecond
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = 10 * time.Second
+	}
+
+	h := &HTTPOutput{
+		options: options,
+		format:  format,
+		queue:   make(chan []httpEntry, options.QueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	h.idle = sync.NewCond(&h.mu)
+
+	h.workers.Add(options.MaxInFlight)
+	for i := 0; i < options.MaxInFlight; i++ {
+		go h.work()
+	}
+	go h.run()
+	return h
+}
+
+// WriteEntry implements EntryWriter, adding the entry to the current batch
+func (h *HTTPOutput) WriteEntry(e *Emitter, entry *Entry) error {
+	he := httpEntry{time: entry.Time, doc: h.format.encode(e, entry)}
+	if f, ok := h.format.(httpStreamFormat); ok {
+		he.stream = f.stream(entry.Tag, entry.Level, e.fields, entry.Fields)
+	}
+	return h.add(he)
+}
+
+// Write implements io.Writer, adding the document as it is to the current batch, as an untagged Info entry
+func (h *HTTPOutput) Write(p []byte) (int, error) {
+	entry := httpEntry{time: time.Now(), doc: h.format.raw(p)}
+	if f, ok := h.format.(httpStreamFormat); ok {
+		entry.stream = f.stream("", Info, nil, nil)
+	}
+	if err := h.add(entry); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the batch is locked
+func (h *HTTPOutput) Concurrent() bool {
+	return true
+}
+
+// Dropped returns how many entries were dropped, because the queue was full or the requests kept failing
+func (h *HTTPOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Sync sends the current batch and waits until every batch is sent
+func (h *HTTPOutput) Sync() error {
+	h.flush(true)
+
+	h.mu.Lock()
+	for h.pending > 0 {
+		h.idle.Wait()
+	}
+	h.mu.Unlock()
+	return nil
+}
+
+// Close sends the pending batches and stops the goroutines.
+// Failing requests are not retried anymore, and entries written afterwards fail with ErrClosed.
+func (h *HTTPOutput) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	batch := h.cut()
+	h.mu.Unlock()
+
+	close(h.stop)
+	<-h.done
+	h.senders.Wait()
+	h.enqueue(batch, true)
+	close(h.queue)
+	h.workers.Wait()
+	return nil
+}
+
+func (h *HTTPOutput) add(entry httpEntry) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return ErrClosed
+	}
+	h.batch = append(h.batch, entry)
+	h.size += len(entry.doc)
+	full := len(h.batch) >= h.options.BatchCount || h.size >= h.options.BatchBytes
+	h.mu.Unlock()
+
+	if full {
+		h.flush(false)
+	}
+	return nil
+}
+
+// flush queues the current batch, waiting for room in the queue when block is set
+func (h *HTTPOutput) flush(block bool) {
+	h.mu.Lock()
+	batch := h.cut()
+	if len(batch) > 0 {
+		// Close waits for the batch to be queued before closing the queue
+		h.senders.Add(1)
+	}
+	h.mu.Unlock()
+
+	if len(batch) > 0 {
+		h.enqueue(batch, block)
+		h.senders.Done()
+	}
+}
+
+// cut returns the current batch and starts a new one, the lock being held
+func (h *HTTPOutput) cut() []httpEntry {
+	batch := h.batch
+	h.batch, h.size = nil, 0
+	if len(batch) > 0 {
+		h.pending++
+	}
+	return batch
+}
+
+// enqueue queues the batch for the workers. When the queue is full, it waits for room
+// when block is set, as Sync and Close do not drop the pending batches, and follows the overflow policy otherwise.
+func (h *HTTPOutput) enqueue(batch []httpEntry, block bool) {
+	if len(batch) == 0 {
+		return
+	}
+	if block || h.options.Overflow == OverflowBlock {
+		h.queue <- batch
+		return
+	}
+	for {
+		select {
+		case h.queue <- batch:
+			return
+		default:
+		}
+		if h.options.Overflow == OverflowDropOldest {
+			select {
+			case old := <-h.queue:
+				h.drop(old)
+				continue
+			default:
+			}
+		}
+		h.drop(batch)
+		return
+	}
+}
+
+// drop counts the entries of a batch not sent
+func (h *HTTPOutput) drop(batch []httpEntry) {
+	atomic.AddUint64(&h.dropped, uint64(len(batch)))
+	h.sent()
+}
+
+// sent marks a batch as handled, either sent or dropped
+func (h *HTTPOutput) sent() {
+	h.mu.Lock()
+	h.pending--
+	if h.pending == 0 {
+		h.idle.Broadcast()
+	}
+	h.mu.Unlock()
+}
+
+func (h *HTTPOutput) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.flush(false)
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+func (h *HTTPOutput) work() {
+	defer h.workers.Done()
+
+	var body, compressed bytes.Buffer
+	for batch := range h.queue {
+		if err := h.post(batch, &body, &compressed); err != nil {
+			h.error(err)
+		}
+		h.sent()
+	}
+}
+
+// payload renders the request body of the batch
+func (h *HTTPOutput) payload(batch []httpEntry, body, compressed *bytes.Buffer) []byte {
+	body.Reset()
+	h.format.body(body, batch)
+	if !h.options.Gzip {
+		return body.Bytes()
+	}
+	compressed.Reset()
+	gz := gzip.NewWriter(compressed)
+	gz.Write(body.Bytes())
+	gz.Close()
+	return compressed.Bytes()
+}
+
+// post sends the batch, retrying with an exponential backoff with jitter, and counts the entries not sent.
+// With the bulk formats, only the entries failing temporarily are sent again.
+func (h *HTTPOutput) post(batch []httpEntry, body, compressed *bytes.Buffer) error {
+	for attempt := 0; ; attempt++ {
+		response, err := h.request(h.payload(batch, body, compressed))
+		if err == nil {
+			f, ok := h.format.(httpBulkFormat)
+			if !ok {
+				return nil
+			}
+			retry, rejected, rerr := f.results(response, batch)
+			if rerr != nil {
+				atomic.AddUint64(&h.dropped, uint64(rejected))
+				h.error(rerr)
+			}
+			if len(retry) == 0 {
+				return nil
+			}
+			batch = retry
+			err = fmt.Errorf("log: http: %s failed to index %d documents", h.options.URL, len(retry))
+		} else if status, ok := err.(httpStatusError); ok && !status.retryable() {
+			atomic.AddUint64(&h.dropped, uint64(len(batch)))
+			return err
+		}
+		if attempt >= h.options.MaxRetries {
+			atomic.AddUint64(&h.dropped, uint64(len(batch)))
+			return err
+		}
+
+		backoff := h.options.MinBackoff << uint(attempt)
+		if backoff > h.options.MaxBackoff || backoff <= 0 {
+			backoff = h.options.MaxBackoff
+		}
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff)) + 1)):
+		case <-h.stop:
+			atomic.AddUint64(&h.dropped, uint64(len(batch)))
+			return err
+		}
+	}
+}
+
+// request posts the body, returning the response body with the bulk formats
+func (h *HTTPOutput) request(body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, h.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range h.options.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", h.format.contentType())
+	if h.options.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := h.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, httpStatusError{url: h.options.URL, status: resp.Status, code: resp.StatusCode}
+	}
+	if _, ok := h.format.(httpBulkFormat); !ok {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, nil
+	}
+	response, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, fmt.Errorf("log: http: reading the response of %s: %v", h.options.URL, err)
+	}
+	return response, nil
+}
+
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("log: http: %s returned %s", e.url, e.status)
+}
+
+// retryable tells whether the request may succeed later
+func (e httpStatusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+func (h *HTTPOutput) error(err error) {
+	if h.options.OnError != nil {
+		h.options.OnError(err)
+		return
+	}
+	h.stats.report(err)
+}
+
+// encodeLine renders the entry with the emitter encoder
+func encodeLine(e *Emitter, entry *Entry) []byte {
+	var buf bytes.Buffer
+	e.encoder().Encode(&buf, e, entry)
+	return buf.Bytes()
+}
+
+type ndjsonFormat struct{}
+
+func (ndjsonFormat) contentType() string {
+	return "application/x-ndjson"
+}
+
+func (ndjsonFormat) encode(e *Emitter, entry *Entry) []byte {
+	return encodeLine(e, entry)
+}
+
+func (ndjsonFormat) raw(p []byte) []byte {
+	doc := append([]byte(nil), bytes.TrimRight(p, "\n")...)
+	return append(doc, '\n')
+}
+
+func (ndjsonFormat) body(buf *bytes.Buffer, batch []httpEntry) {
+	for _, entry := range batch {
+		buf.Write(entry.doc)
+	}
+}
+
+type elasticsearchFormat struct {
+	index string
+}
+
+func (elasticsearchFormat) contentType() string {
+	return "application/x-ndjson"
+}
+
+// action renders the index action preceding each document
+func (f elasticsearchFormat) action(buf *bytes.Buffer) {
+	buf.WriteString(`{"index":{"_index":`)
+	writeJSONString(buf, f.index)
+	buf.WriteString("}}\n")
+}
+
+// encode renders the index action and the JSON document, with the time as @timestamp
+func (f elasticsearchFormat) encode(e *Emitter, entry *Entry) []byte {
+	var buf bytes.Buffer
+	f.action(&buf)
+	buf.WriteString(`{"@timestamp":"`)
+	buf.WriteString(entry.Time.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`",`)
+	start := buf.Len()
+	JSONEncoder{}.Encode(&buf, e, entry)
+
+	// drop the opening brace of the document
+	doc := buf.Bytes()
+	return append(doc[:start], doc[start+1:]...)
+}
+
+func (f elasticsearchFormat) raw(p []byte) []byte {
+	var buf bytes.Buffer
+	f.action(&buf)
+	buf.Write(bytes.TrimRight(p, "\n"))
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func (elasticsearchFormat) body(buf *bytes.Buffer, batch []httpEntry) {
+	for _, entry := range batch {
+		buf.Write(entry.doc)
+	}
+}
+
+// elasticsearchBulkResponse is the response of the bulk API, with an item per document
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// results returns the documents failing with a 429 or a 5xx status, and reports the other failures
+func (elasticsearchFormat) results(response []byte, batch []httpEntry) ([]httpEntry, int, error) {
+	var r elasticsearchBulkResponse
+	if err := json.Unmarshal(response, &r); err != nil {
+		return nil, 0, fmt.Errorf("log: http: invalid bulk response: %v", err)
+	}
+	if !r.Errors {
+		return nil, 0, nil
+	}
+
+	var retry []httpEntry
+	var rejected int
+	var first string
+	for i, item := range r.Items {
+		if i >= len(batch) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+				retry = append(retry, batch[i])
+			case result.Status > 299 || result.Error != nil:
+				rejected++
+				if first == "" && result.Error != nil {
+					first = result.Error.Type + ": " + result.Error.Reason
+				}
+			}
+		}
+	}
+	if rejected == 0 {
+		return retry, 0, nil
+	}
+	return retry, rejected, fmt.Errorf("log: http: elasticsearch rejected %d documents, first: %s", rejected, first)
+}
+
+type lokiFormat struct {
+	labels []string
+}
+
+func (lokiFormat) contentType() string {
+	return "application/json"
+}
+
+func (lokiFormat) encode(e *Emitter, entry *Entry) []byte {
+	return bytes.TrimRight(encodeLine(e, entry), "\n")
+}
+
+func (lokiFormat) raw(p []byte) []byte {
+	return append([]byte(nil), bytes.TrimRight(p, "\n")...)
+}
+
+// body renders the push request, with a stream per distinct set of labels
+func (f lokiFormat) body(buf *bytes.Buffer, batch []httpEntry) {
+	var keys []string
+	streams := map[string][]int{}
+	for i, entry := range batch {
+		if _, ok := streams[entry.stream]; !ok {
+			keys = append(keys, entry.stream)
+		}
+		streams[entry.stream] = append(streams[entry.stream], i)
+	}
+
+	buf.WriteString(`{"streams":[`)
+	for i, labels := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"stream":`)
+		buf.WriteString(labels)
+		buf.WriteString(`,"values":[`)
+		for j, index := range streams[labels] {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			entry := batch[index]
+			buf.WriteString(`["`)
+			buf.WriteString(strconv.FormatInt(entry.time.UnixNano(), 10))
+			buf.WriteString(`",`)
+			writeJSONString(buf, string(entry.doc))
+			buf.WriteByte(']')
+		}
+		buf.WriteString(`]}`)
+	}
+	buf.WriteString(`]}`)
+}
+
+// stream renders the labels of the entry, which are the key of its stream.
+// It is rendered when the entry is written, as the fields may change afterwards.
+func (f lokiFormat) stream(tag string, level Level, context, fields []interface{}) string {
+	var buf bytes.Buffer
+	buf.WriteString(`{"tag":`)
+	writeJSONString(&buf, tag)
+labels:
+	for _, label := range f.labels {
+		if label == "level" {
+			buf.WriteString(`,"level":`)
+			writeJSONString(&buf, level.String())
+			continue
+		}
+		for _, fields := range [2][]interface{}{context, fields} {
+			for i := 0; i+1 < len(fields); i += 2 {
+				if keyString(fields[i]) == label {
+					buf.WriteByte(',')
+					writeJSONString(&buf, label)
+					buf.WriteByte(':')
+					writeJSONString(&buf, valueString(fields[i+1]))
+					continue labels
+				}
+			}
+		}
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
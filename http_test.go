@@ -0,0 +1,432 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// httpServer records the bodies of the requests, answering with the statuses given in order, then 204
+type httpServer struct {
+	*httptest.Server
+
+	// bulk answers the successful requests like the Elasticsearch bulk API, indexing every document
+	bulk bool
+
+	mu       sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	statuses []int
+}
+
+func newHTTPServer(statuses ...int) *httpServer {
+	return startHTTPServer(&httpServer{statuses: statuses})
+}
+
+func newBulkServer() *httpServer {
+	return startHTTPServer(&httpServer{bulk: true})
+}
+
+func startHTTPServer(s *httpServer) *httpServer {
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		b, _ := ioutil.ReadAll(body)
+
+		s.mu.Lock()
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		if status < 300 {
+			s.bodies = append(s.bodies, string(b))
+			s.headers = append(s.headers, r.Header)
+		}
+		s.mu.Unlock()
+
+		if s.bulk && status < 300 {
+			items := strings.Repeat(`{"index":{"status":201}},`, bytes.Count(b, []byte("\n"))/2)
+			io.WriteString(w, `{"errors":false,"items":[`+strings.TrimSuffix(items, ",")+`]}`)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *httpServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func TestHTTPOutputNDJSON(t *testing.T) {
+	server := newHTTPServer()
+	defer server.Close()
+
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:           server.URL,
+		Header:        http.Header{"Authorization": {"Bearer token"}},
+		Gzip:          true,
+		BatchCount:    2,
+		FlushInterval: time.Hour,
+	})
+	e := log.New(log.WithOutput(out), log.WithEncoder(log.JSONEncoder{}))
+	e.I("test", "one")
+	e.I("test", "two")
+	e.I("test", "three")
+
+	// the first batch is full, the second one is sent when closing
+	waitFor(t, "the first batch", func() bool { return len(server.received()) == 1 })
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`{"tag":"test","level":"info","msg":"one"}` + "\n" + `{"tag":"test","level":"info","msg":"two"}` + "\n",
+		`{"tag":"test","level":"info","msg":"three"}` + "\n",
+	}
+	if got := server.received(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("invalid bodies:\nwant: %q\ngot: %q", want, got)
+	}
+	header := server.headers[0]
+	if header.Get("Authorization") != "Bearer token" || header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("invalid headers: %v", header)
+	}
+
+	if err := out.WriteEntry(e, &log.Entry{Message: "late"}); err != log.ErrClosed {
+		t.Errorf("invalid error after close: %v", err)
+	}
+}
+
+func TestHTTPOutputLoki(t *testing.T) {
+	server := newHTTPServer()
+	defer server.Close()
+
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:        server.URL,
+		Format:     log.HTTPLoki,
+		LokiLabels: []string{"level", "region", "zone"},
+	})
+	defer out.Close()
+	e := log.New(log.WithOutput(out), log.WithEncoder(log.JSONEncoder{}), log.WithFields("region", "us"))
+	e.I("http", "one")
+	e.W("http", "two")
+	e.I("http", "three", "status", 200)
+	e.I("db", "four")
+
+	// the labels are taken when logging, the caller may reuse the fields
+	fields := []interface{}{"zone", "a"}
+	e.I("db", "five", fields...)
+	fields[1] = "b"
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	bodies := server.received()
+	if len(bodies) != 1 {
+		t.Fatalf("invalid requests: %q", bodies)
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &push); err != nil {
+		t.Fatalf("invalid body %s: %v", bodies[0], err)
+	}
+
+	want := []struct {
+		labels string
+		lines  []string
+	}{
+		{"map[level:info region:us tag:http]", []string{"one", "three"}},
+		{"map[level:warn region:us tag:http]", []string{"two"}},
+		{"map[level:info region:us tag:db]", []string{"four"}},
+		{"map[level:info region:us tag:db zone:a]", []string{"five"}},
+	}
+	if len(push.Streams) != len(want) {
+		t.Fatalf("invalid streams: %+v", push.Streams)
+	}
+	for i, stream := range push.Streams {
+		if labels := fmt.Sprint(stream.Stream); labels != want[i].labels || len(stream.Values) != len(want[i].lines) {
+			t.Errorf("invalid stream %d: %+v", i, stream)
+			continue
+		}
+		for j, value := range stream.Values {
+			if !strings.Contains(value[1], `"msg":"`+want[i].lines[j]+`"`) {
+				t.Errorf("invalid line: %s", value[1])
+			}
+			if ns := value[0]; len(ns) < 19 || ns[0] == '-' {
+				t.Errorf("invalid timestamp: %s", ns)
+			}
+		}
+	}
+}
+
+func TestHTTPOutputElasticsearch(t *testing.T) {
+	server := newBulkServer()
+	defer server.Close()
+
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:     server.URL,
+		Format:  log.HTTPElasticsearch,
+		Index:   "logs",
+		OnError: func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	e := log.New(log.WithOutput(out), log.WithFields("request", "abc"))
+	e.E("http", "failed", "status", 500)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := server.received()
+	if len(bodies) != 1 {
+		t.Fatalf("invalid requests: %q", bodies)
+	}
+	s := bufio.NewScanner(strings.NewReader(bodies[0]))
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if len(lines) != 2 || lines[0] != `{"index":{"_index":"logs"}}` {
+		t.Fatalf("invalid body: %q", bodies[0])
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &doc); err != nil {
+		t.Fatalf("invalid document %s: %v", lines[1], err)
+	}
+	if ts, _ := time.Parse(time.RFC3339Nano, doc["@timestamp"].(string)); time.Since(ts) > time.Minute {
+		t.Errorf("invalid timestamp: %v", doc["@timestamp"])
+	}
+	if doc["msg"] != "failed" || doc["tag"] != "http" || doc["request"] != "abc" || doc["status"] != 500.0 {
+		t.Errorf("invalid document: %v", doc)
+	}
+}
+
+func TestHTTPOutputElasticsearchBulkErrors(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	responses := []string{
+		`{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}},` +
+			`{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`,
+		`{"errors":false,"items":[{"index":{"status":201}}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(b))
+		if len(bodies) <= len(responses) {
+			io.WriteString(w, responses[len(bodies)-1])
+		}
+	}))
+	defer server.Close()
+
+	var errs []string
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:           server.URL,
+		Format:        log.HTTPElasticsearch,
+		Index:         "logs",
+		FlushInterval: time.Hour,
+		MinBackoff:    time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	})
+	e := log.New(log.WithOutput(out))
+	e.I("test", "indexed")
+	e.I("test", "throttled")
+	e.I("test", "invalid")
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || strings.Count(bodies[1], `"_index"`) != 1 || !strings.Contains(bodies[1], `"msg":"throttled"`) {
+		t.Fatalf("invalid requests: %q", bodies)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0], "rejected 1 documents, first: mapper_parsing_exception: failed to parse") {
+		t.Errorf("invalid errors: %q", errs)
+	}
+	if out.Dropped() != 1 {
+		t.Errorf("invalid dropped count: %d", out.Dropped())
+	}
+}
+
+func TestHTTPOutputRetry(t *testing.T) {
+	server := newHTTPServer(http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK, http.StatusBadRequest)
+	defer server.Close()
+
+	var errs []error
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:        server.URL,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+		OnError:    func(err error) { errs = append(errs, err) },
+	})
+	defer out.Close()
+	e := log.New(log.WithOutput(out), log.WithEncoder(log.JSONEncoder{}))
+
+	// the transient failures are retried
+	e.I("test", "one")
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.received(); len(got) != 1 || len(errs) != 0 {
+		t.Fatalf("the batch was not retried: %q, %v", got, errs)
+	}
+
+	// but not the bad requests
+	e.I("test", "two")
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "400 Bad Request") || out.Dropped() != 1 {
+		t.Errorf("the batch was not dropped: %v, %d dropped", errs, out.Dropped())
+	}
+}
+
+func TestHTTPOutputMaxInFlight(t *testing.T) {
+	var inFlight, max int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer server.Close()
+
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:         server.URL,
+		BatchCount:  1,
+		MaxInFlight: 2,
+		QueueSize:   2,
+	})
+	e := log.New(log.WithOutput(out))
+	e.I("test", "one")
+	e.I("test", "two")
+
+	// two batches are sent, two wait in the queue, and the others are dropped
+	waitFor(t, "the requests", func() bool { return atomic.LoadInt32(&inFlight) == 2 })
+	for i := 0; i < 4; i++ {
+		e.I("test", "more")
+	}
+	if dropped := out.Dropped(); dropped != 2 {
+		t.Errorf("invalid dropped entries: %d", dropped)
+	}
+	close(release)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if max := atomic.LoadInt32(&max); max != 2 {
+		t.Errorf("invalid requests in flight: %d", max)
+	}
+}
+
+func TestHTTPOutputFlushFullQueue(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		flush func(e *log.Emitter) error
+	}{
+		{"Sync", (*log.Emitter).Sync},
+		{"Close", (*log.Emitter).Close},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var requests, lines int32
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				<-release
+				b, _ := ioutil.ReadAll(r.Body)
+				atomic.AddInt32(&lines, int32(bytes.Count(b, []byte("\n"))))
+			}))
+			defer server.Close()
+
+			out := log.NewHTTPOutput(log.HTTPOptions{
+				URL:           server.URL,
+				BatchCount:    2,
+				FlushInterval: time.Hour,
+				MaxInFlight:   1,
+				QueueSize:     1,
+			})
+			e := log.New(log.WithOutput(out))
+
+			// a batch is sent, another one waits in the queue and the last one is pending
+			e.I("test", "one")
+			e.I("test", "two")
+			waitFor(t, "the request", func() bool { return atomic.LoadInt32(&requests) == 1 })
+			e.I("test", "three")
+			e.I("test", "four")
+			e.I("test", "five")
+
+			flushed := make(chan error, 1)
+			go func() { flushed <- test.flush(e) }()
+			select {
+			case err := <-flushed:
+				t.Fatalf("flushed before the queue had room: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+			if err := <-flushed; err != nil {
+				t.Fatal(err)
+			}
+
+			if got := atomic.LoadInt32(&lines); got != 5 || out.Dropped() != 0 {
+				t.Errorf("the pending batch was dropped: %d entries sent, %d dropped", got, out.Dropped())
+			}
+			out.Close()
+		})
+	}
+}
+
+func TestHTTPOutputWrite(t *testing.T) {
+	server := newBulkServer()
+	defer server.Close()
+
+	out := log.NewHTTPOutput(log.HTTPOptions{
+		URL:     server.URL,
+		Format:  log.HTTPElasticsearch,
+		Index:   "raw",
+		OnError: func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	if _, err := io.WriteString(out, `{"msg":"raw"}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	want := `{"index":{"_index":"raw"}}` + "\n" + `{"msg":"raw"}` + "\n"
+	if got := server.received(); len(got) != 1 || got[0] != want {
+		t.Errorf("invalid body:\nwant: %q\ngot: %q", want, got)
+	}
+}
@@ -0,0 +1,194 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// journaldSocket is the socket the journal daemon receives native entries on
+const journaldSocket = "/run/systemd/journal/socket"
+
+var errJournalTooLarge = errors.New("log: journald: entry too large")
+
+// JournaldOptions configures NewJournald. The zero value writes to the local journal.
+type JournaldOptions struct {
+	// Socket is the journal socket, /run/systemd/journal/socket when empty
+	Socket string
+
+	// Identifier is the SYSLOG_IDENTIFIER of the untagged entries, the executable name when empty
+	Identifier string
+}
+
+// Journald is an output sending the entries to systemd-journald with its native protocol,
+// so they keep their priority and fields.
+//
+// Levels are mapped to PRIORITY like syslog severities, see Syslog. The tag is sent as
+// SYSLOG_IDENTIFIER, the message as MESSAGE, and the fields as upper-cased journal fields,
+// with the characters other than letters, digits and underscores replaced by underscores.
+// Fields named like the header ones are prefixed with FIELD_, like FIELD_MESSAGE.
+//
+// Entries too large for a datagram are passed in a sealed memfd on Linux, like sd_journal_send does.
+type Journald struct {
+	options JournaldOptions
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+	buf  bytes.Buffer
+}
+
+// NewJournald connects to the journal socket
+func NewJournald(options JournaldOptions) (*Journald, error) {
+	if options.Socket == "" {
+		options.Socket = journaldSocket
+	}
+	if options.Identifier == "" {
+		options.Identifier = filepath.Base(os.Args[0])
+	}
+
+	j := &Journald{options: options}
+	if err := j.dial(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// WriteEntry implements EntryWriter
+func (j *Journald) WriteEntry(e *Emitter, entry *Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.buf.Reset()
+	j.writeHeader(entry.Tag, entry.Level, entry.Message)
+	j.writeFields(e.fields)
+	j.writeFields(entry.Fields)
+	return j.send()
+}
+
+// Write implements io.Writer, sending the document as the message of an untagged Info entry
+func (j *Journald) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.buf.Reset()
+	j.writeHeader("", Info, string(bytes.TrimRight(p, "\n")))
+	if err := j.send(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the connection is locked
+func (j *Journald) Concurrent() bool {
+	return true
+}
+
+// Close closes the connection
+func (j *Journald) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+func (j *Journald) dial() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: j.options.Socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	j.conn = conn
+	return nil
+}
+
+// send writes the buffer, passing it in a file when too large,
+// and dialing again once when the journal restarted
+func (j *Journald) send() error {
+	if j.conn == nil {
+		if err := j.dial(); err != nil {
+			return err
+		}
+	}
+
+	_, err := j.conn.Write(j.buf.Bytes())
+	if err == nil {
+		return nil
+	}
+	if tooLarge(err) {
+		return j.sendFile(j.buf.Bytes())
+	}
+
+	j.conn.Close()
+	j.conn = nil
+	if err := j.dial(); err != nil {
+		return err
+	}
+	_, err = j.conn.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *Journald) writeHeader(tag string, level Level, message string) {
+	j.writeField("PRIORITY", strconv.Itoa(level.Severity()))
+	if tag == "" {
+		tag = j.options.Identifier
+	}
+	j.writeField("SYSLOG_IDENTIFIER", tag)
+	j.writeField("MESSAGE", message)
+}
+
+func (j *Journald) writeFields(fields []interface{}) {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if name := journalFieldName(keyString(fields[i])); name != "" {
+			j.writeField(name, valueString(fields[i+1]))
+		}
+	}
+}
+
+// writeField writes NAME=value, or the binary form when the value spans several lines
+func (j *Journald) writeField(name, value string) {
+	j.buf.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		j.buf.WriteByte('=')
+		j.buf.WriteString(value)
+		j.buf.WriteByte('\n')
+		return
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	j.buf.WriteByte('\n')
+	j.buf.Write(size[:])
+	j.buf.WriteString(value)
+	j.buf.WriteByte('\n')
+}
+
+// journalHeaderFields are the fields written from the entry header, which the entry fields cannot override
+var journalHeaderFields = map[string]bool{"PRIORITY": true, "SYSLOG_IDENTIFIER": true, "MESSAGE": true}
+
+// journalFieldName makes the key a valid journal field name, empty when impossible.
+// Names are upper case letters, digits and underscores, and start with a letter.
+func journalFieldName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+	name := strings.TrimLeft(string(b), "_0123456789")
+	if journalHeaderFields[name] {
+		name = "FIELD_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// memfd_create is missing from the syscall package on most architectures
+var sysMemfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}[runtime.GOARCH]
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fcntlAddSeals   = 1033
+	sealAll         = 0x1 | 0x2 | 0x4 | 0x8 // seal, shrink, grow and write
+)
+
+// tooLarge tells whether the datagram was refused for its size
+func tooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendFile passes the entry in a sealed memfd, or in an unlinked file in /dev/shm
+// on kernels without memfd, like sd_journal_send does
+func (j *Journald) sendFile(p []byte) error {
+	f, err := memfd(p)
+	if err != nil {
+		if f, err = unlinkedFile(p); err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+
+	// the connection is connected, which WriteMsgUnix refuses for datagrams
+	raw, err := j.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	var serr error
+	if err := raw.Write(func(fd uintptr) bool {
+		serr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return serr != syscall.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func memfd(p []byte) (*os.File, error) {
+	if sysMemfdCreate == 0 {
+		return nil, errJournalTooLarge
+	}
+	name, err := syscall.BytePtrFromString("journal-entry")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(sysMemfdCreate, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	f := os.NewFile(fd, "journal-entry")
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fcntlAddSeals, sealAll); errno != 0 {
+		f.Close()
+		return nil, errno
+	}
+	return f, nil
+}
+
+func unlinkedFile(p []byte) (*os.File, error) {
+	f, err := ioutil.TempFile("/dev/shm", "journal-entry")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package log
+
+func tooLarge(err error) bool {
+	return false
+}
+
+func (j *Journald) sendFile(p []byte) error {
+	return errJournalTooLarge
+}
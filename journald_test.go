@@ -0,0 +1,121 @@
+//go:build linux
+// +build linux
+
+package log_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// parseJournal decodes the fields of a native journal entry
+func parseJournal(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for len(b) > 0 {
+		i := strings.IndexAny(string(b), "=\n")
+		if i < 0 {
+			t.Fatalf("invalid entry: %q", b)
+		}
+		name := string(b[:i])
+		if b[i] == '=' {
+			end := strings.IndexByte(string(b), '\n')
+			fields[name] = string(b[i+1 : end])
+			b = b[end+1:]
+			continue
+		}
+		size := int(binary.LittleEndian.Uint64(b[i+1 : i+9]))
+		fields[name] = string(b[i+9 : i+9+size])
+		b = b[i+10+size:]
+	}
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	out, err := log.NewJournald(log.JournaldOptions{Socket: path, Identifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out), log.WithFields("request-id", "abc"))
+
+	buf := make([]byte, 1<<20)
+	oob := make([]byte, 1024)
+	receive := func() map[string]string {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oobn == 0 {
+			return parseJournal(t, buf[:n])
+		}
+
+		// large entries are passed in a file
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "entry")
+		defer f.Close()
+		info, _ := f.Stat()
+		b := make([]byte, info.Size())
+		if _, err := f.ReadAt(b, 0); err != nil {
+			t.Fatal(err)
+		}
+		return parseJournal(t, b)
+	}
+
+	e.W("http", "slow request", "duration_ms", 1200, "2nd.try", true, "stack", "one\ntwo",
+		"message", "override", "priority", 0)
+	fields := receive()
+	want := map[string]string{
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "http",
+		"MESSAGE":           "slow request",
+		"REQUEST_ID":        "abc",
+		"DURATION_MS":       "1200",
+		"ND_TRY":            "true",
+		"STACK":             "one\ntwo",
+		"FIELD_MESSAGE":     "override",
+		"FIELD_PRIORITY":    "0",
+	}
+	for name, value := range want {
+		if fields[name] != value {
+			t.Errorf("invalid field %s: want %q, got %q", name, value, fields[name])
+		}
+	}
+
+	large := strings.Repeat("x", 512<<10)
+	e.E("", large)
+	fields = receive()
+	if fields["MESSAGE"] != large || fields["PRIORITY"] != "3" || fields["SYSLOG_IDENTIFIER"] != "app" {
+		t.Errorf("invalid large entry: %d bytes, priority %s", len(fields["MESSAGE"]), fields["PRIORITY"])
+	}
+}
@@ -1,13 +1,20 @@
 package log
 
 import (
+	"errors"
+	"strconv"
 	"strings"
 )
 
+// Levels are spaced apart so custom levels can be registered between them.
 const (
-	// Trace is a log level used mainly for debugging purposes.
+	// Trace is a log level used for very verbose debugging output.
 	// As this is the basic level, all other logs are emitted.
-	Trace Level = iota
+	Trace Level = (iota + 1) * 10
+
+	// Debug is a log level used mainly for debugging purposes.
+	// This level enables Info, Warn, Error and Fatal levels too.
+	Debug
 
 	// Info is a log level used to register relevant information about a process.
 	// This level enables Warn, Error and Fatal levels too.
@@ -18,9 +25,13 @@ const (
 	Warn
 
 	// Error is a log level that desired some attention. Usually indicated something very important.
-	// This level enables the Fatal level too.
+	// This level enables Panic and Fatal levels too.
 	Error
 
+	// Panic is a log level that indicates something very wrong, and also causes the logger to panic.
+	// This level enables the Fatal level too.
+	Panic
+
 	// Fatal is a log level that indicates something very wrong, and also causes the application to halt.
 	Fatal
 )
@@ -29,34 +40,99 @@ const (
 type Level byte
 
 func (l Level) String() string {
-	switch l {
-	case Trace:
-		return "debug"
-	case Info:
-		return "info"
-	case Warn:
-		return "warn"
-	case Error:
-		return "error"
-	case Fatal:
-		return "fatal"
+	if def := levels[l]; def.name != "" {
+		return def.name
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Severity returns the syslog severity (0 to 7) matching the level.
+//
+// Unregistered levels take the severity of the closest registered level below them.
+func (l Level) Severity() int {
+	for i := int(l); i >= 0; i-- {
+		if levels[i].name != "" {
+			return levels[i].severity
+		}
+	}
+	return levels[Trace].severity
+}
+
+// LevelFormat selects how an Emitter spells levels in its output
+type LevelFormat byte
+
+const (
+	// LevelLower writes the level name in lower case, like "info". This is the default.
+	LevelLower LevelFormat = iota
+
+	// LevelUpper writes the level name in upper case, like "INFO".
+	LevelUpper
+
+	// LevelSeverity writes the syslog severity number of the level, like 6.
+	LevelSeverity
+)
+
+type levelDef struct {
+	name     string
+	upper    string
+	severity int
+}
+
+// levels is indexed by Level, so looking up a name costs nothing while emitting
+var levels [256]levelDef
+
+func init() {
+	levels[Trace] = levelDef{"trace", "TRACE", 7}
+	levels[Debug] = levelDef{"debug", "DEBUG", 7}
+	levels[Info] = levelDef{"info", "INFO", 6}
+	levels[Warn] = levelDef{"warn", "WARN", 4}
+	levels[Error] = levelDef{"error", "ERROR", 3}
+	levels[Panic] = levelDef{"panic", "PANIC", 2}
+	levels[Fatal] = levelDef{"fatal", "FATAL", 2}
+}
+
+// RegisterLevel names a custom level, or renames an existing one.
+// The severity is the syslog severity (0 to 7) used when the level is written as a number.
+//
+// The common use case is
+//
+//	const Notice = log.Info + 5
+//	log.RegisterLevel(Notice, "notice", 5)
+//	log.Default.Emit("TAG", Notice, "hello")
+//
+// RegisterLevel is not safe to call while logging, so do it during initialization.
+func RegisterLevel(level Level, name string, severity int) error {
+	name = strings.ToLower(name)
+	if name == "" {
+		return errors.New("log: empty level name")
+	}
+	if severity < 0 || severity > 7 {
+		return errors.New("log: invalid severity " + strconv.Itoa(severity) + " for level " + name)
+	}
+	if other, err := ParseLevel(name); err == nil && other != level {
+		return errors.New("log: level name " + name + " is already registered")
+	}
+	levels[level] = levelDef{name, strings.ToUpper(name), severity}
+	return nil
+}
+
+// ParseLevel returns the level registered with the given name, ignoring case
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(name)
+	for i := range levels {
+		if levels[i].name != "" && levels[i].name == name {
+			return Level(i), nil
+		}
 	}
-	return ""
+	return 0, errors.New("log: unknown level " + strconv.Quote(name))
 }
 
 // SetLevel configures the logging level by parsing the given string.
 // The default level is Info.
 func SetLevel(level string) {
-	switch strings.ToLower(level) {
-	case "trace", "debug":
-		Default.Level = Trace
-	case "warn":
-		Default.Level = Warn
-	case "error":
-		Default.Level = Error
-	case "fatal":
-		Default.Level = Fatal
-	default:
-		Default.Level = Info
+	l, err := ParseLevel(level)
+	if err != nil {
+		l = Info
 	}
+	Default.Level = l
 }
@@ -1,6 +1,8 @@
 package log_test
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/bemobi/log"
@@ -17,6 +19,11 @@ func TestLevel(t *testing.T) {
 			Level: "trace",
 			Want:  log.Trace,
 		},
+		{
+			Name:  "Debug",
+			Level: "debug",
+			Want:  log.Debug,
+		},
 		{
 			Name:  "Info",
 			Level: "info",
@@ -53,3 +60,88 @@ func TestLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"", "verbose", "Warning"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := log.ParseLevel(name); err == nil {
+				t.Errorf("level %q should not parse", name)
+			}
+		})
+	}
+
+	for name, want := range map[string]log.Level{"TRACE": log.Trace, "Debug": log.Debug, "fatal": log.Fatal} {
+		t.Run(name, func(t *testing.T) {
+			got, err := log.ParseLevel(name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != want {
+				t.Errorf("got %d; want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	const notice = log.Info + 5
+	if err := log.RegisterLevel(notice, "Notice", 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := notice.String(); got != "notice" {
+		t.Errorf("got name %q; want notice", got)
+	}
+	if got := notice.Severity(); got != 5 {
+		t.Errorf("got severity %d; want 5", got)
+	}
+	if got, err := log.ParseLevel("NOTICE"); err != nil || got != notice {
+		t.Errorf("got %d, %v; want %d", got, err, notice)
+	}
+
+	if err := log.RegisterLevel(notice+1, "notice", 5); err == nil {
+		t.Error("registering a duplicated name should fail")
+	}
+	if err := log.RegisterLevel(notice+1, "", 5); err == nil {
+		t.Error("registering an empty name should fail")
+	}
+	if err := log.RegisterLevel(notice+1, "other", 8); err == nil {
+		t.Error("registering an invalid severity should fail")
+	}
+
+	// unregistered levels borrow the severity from the level below
+	if got := (notice + 1).Severity(); got != 5 {
+		t.Errorf("got severity %d; want 5", got)
+	}
+}
+
+func TestLevelFormat(t *testing.T) {
+	const critical = log.Error + 5
+	if err := log.RegisterLevel(critical, "critical", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		Name   string
+		Format log.LevelFormat
+		Level  log.Level
+		Want   string
+	}{
+		{Name: "Lower", Format: log.LevelLower, Level: log.Warn, Want: `"level":"warn"`},
+		{Name: "Upper", Format: log.LevelUpper, Level: log.Warn, Want: `"level":"WARN"`},
+		{Name: "Severity", Format: log.LevelSeverity, Level: log.Warn, Want: `"level":4`},
+		{Name: "Custom Upper", Format: log.LevelUpper, Level: critical, Want: `"level":"CRITICAL"`},
+		{Name: "Custom Severity", Format: log.LevelSeverity, Level: critical, Want: `"level":2`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var sink bytes.Buffer
+			e := &log.Emitter{Output: &sink, LevelFormat: test.Format}
+			e.Emit("test", test.Level, "hello")
+			if !strings.Contains(sink.String(), test.Want) {
+				t.Errorf("got %s; want %s", sink.String(), test.Want)
+			}
+		})
+	}
+}
@@ -7,24 +7,25 @@ import (
 )
 
 func init() {
-	Default = &Emitter{Level: Info, Output: os.Stderr}
+	Default = New()
 }
 
 // Default is the default logger engine
 var Default *Emitter
 
 // SetWithTime configures a logger with timestamp
+//
+// Deprecated: use Configure(WithTimeFormat(time.RFC3339)) instead.
 func SetWithTime() {
-	Default = &Emitter{Level: Info, Output: os.Stderr, TimeFormat: time.RFC3339}
+	Configure(WithTimeFormat(time.RFC3339))
 }
 
-// SetHook configures a logger with an emitter hook
+// SetHook configures a logger with an emitter hook, replacing the current one.
+// A nil hook removes the current one.
+//
+// Deprecated: use Configure(WithHook(hook)) instead, which adds to the current hooks.
 func SetHook(hook Hook) {
-	Default = &Emitter{
-		Level:  Info,
-		Output: os.Stderr,
-		Hook:   hook,
-	}
+	Default.Hook = hook
 }
 
 // T logs a formatted message when the Level is set to Trace
@@ -32,6 +33,11 @@ func T(tag string, message string, v ...interface{}) {
 	Default.Emit(tag, Trace, message, v...)
 }
 
+// D logs a formatted message when the Level is set to Debug or lower
+func D(tag string, message string, v ...interface{}) {
+	Default.Emit(tag, Debug, message, v...)
+}
+
 // I logs a formatted message when the Level is set to Info or lower
 func I(tag string, message string, v ...interface{}) {
 	Default.Emit(tag, Info, message, v...)
@@ -47,16 +53,28 @@ func E(tag string, message string, v ...interface{}) {
 	Default.Emit(tag, Error, message, v...)
 }
 
-// F logs a formatted message when the Level is set to Fatal or lower
+// P logs a formatted message when the Level is set to Panic or lower, and then panics with the message.
+//
+// Like F halting, P panics even when the level filters the message out.
+func P(tag string, message string, v ...interface{}) {
+	Default.Emit(tag, Panic, message, v...)
+	panic(message)
+}
+
+// F logs a formatted message when the Level is set to Fatal or lower, and then halts the application.
+//
+// The exit handlers are called and the output is closed before the application halts,
+// except in testing mode.
 func F(tag string, message string, v ...interface{}) {
 	Default.Emit(tag, Fatal, message, v...)
-	_exit(1)
+	Default.exit()
 }
 
 // SetTestMode toggles the testing mode, which is disabled by default.
 //
 // When testing mode is on, all the logging functions emit values to the first sink (io.Writer)
-// and the program does not halt when logging with F.
+// and the program does not halt when logging with F, unless the Emitter has its own Exit function.
+// F does not call the exit handlers nor close the output either.
 //
 // If you need to test the exit operation when logging with F, check the _exitCode global variable.
 func SetTestMode(active bool, sink ...io.Writer) {
@@ -65,15 +83,18 @@ func SetTestMode(active bool, sink ...io.Writer) {
 		_exit = func(code int) {
 			_exitCode = code
 		}
+		_testMode = true
 		// backup the current logger
 		_logger = Default
 		// create a new logger
 		Default = &Emitter{
-			Output: sink[0],
+			Output: Locked(sink[0]),
 			Hook:   _logger.Hook,
+			shared: &shared{},
 		}
 	} else {
 		_exit = os.Exit
+		_testMode = false
 		Default = _logger
 	}
 }
@@ -90,4 +111,5 @@ var (
 	_exit     = os.Exit
 	_logger   = Default
 	_exitCode = 0
+	_testMode = false
 )
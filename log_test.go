@@ -79,6 +79,25 @@ func TestLog(t *testing.T) {
 			values:  []interface{}{"uint", 1777, "uint32", 127718, "uint64", 100010},
 			want:    map[string]interface{}{},
 		},
+		{
+			level:   log.Debug,
+			emitter: 'D',
+			name:    "D",
+			tag:     "test",
+			msg:     "debugging",
+			want: map[string]interface{}{
+				"level": "debug",
+				"msg":   "debugging",
+				"tag":   "test",
+			},
+		},
+		{
+			level:   log.Info,
+			emitter: 'D',
+			name:    "D Below Level",
+			tag:     "test",
+			want:    map[string]interface{}{},
+		},
 		{
 			level:   log.Error,
 			emitter: 'I',
@@ -219,6 +238,8 @@ func TestLog(t *testing.T) {
 			switch test.emitter {
 			case 'T':
 				log.T(test.tag, test.msg, test.values...)
+			case 'D':
+				log.D(test.tag, test.msg, test.values...)
 			case 'I':
 				log.I(test.tag, test.msg, test.values...)
 			case 'W':
@@ -432,7 +453,7 @@ func TestHook(t *testing.T) {
 		if len(rec[log.Trace]) != 1 {
 			t.Fatal("trace hook was not called once")
 		}
-		want := `{"tag":"test","level":"debug","msg":"1","a":1}` + "\n"
+		want := `{"tag":"test","level":"trace","msg":"1","a":1}` + "\n"
 		got := rec[log.Trace][0]
 		if got != want {
 			t.Errorf("trace is wrong: want[%s] got [%s]", want, got)
@@ -0,0 +1,106 @@
+package log
+
+import (
+	"io"
+)
+
+// Option configures an Emitter, see New and Configure
+type Option func(*Emitter)
+
+// Configure applies the options to the emitter, keeping everything else as it is
+func (e *Emitter) Configure(options ...Option) {
+	for _, option := range options {
+		option(e)
+	}
+}
+
+// Configure applies the options to the Default emitter, keeping everything else as it is
+//
+// The common use case is
+//
+//	log.Configure(log.WithLevel(log.Debug), log.WithTimeFormat(time.RFC3339))
+func Configure(options ...Option) {
+	Default.Configure(options...)
+}
+
+// WithOutput sets the writer receiving the entries, locking it unless it is safe for concurrent use.
+// See Locked.
+func WithOutput(output io.Writer) Option {
+	return func(e *Emitter) {
+		e.Output = Locked(output)
+	}
+}
+
+// WithLevel sets the minimum level emitted
+func WithLevel(level Level) Option {
+	return func(e *Emitter) {
+		e.Level = level
+	}
+}
+
+// WithTagLevel sets the minimum level emitted for a specific tag
+func WithTagLevel(tag string, level Level) Option {
+	return func(e *Emitter) {
+		tags := make(map[string]Level, len(e.TagLevels)+1)
+		for t, l := range e.TagLevels {
+			tags[t] = l
+		}
+		tags[tag] = level
+		e.TagLevels = tags
+	}
+}
+
+// WithTimeFormat sets the layout of the entries time, as in time.Format.
+// An empty format omits the time.
+func WithTimeFormat(format string) Option {
+	return func(e *Emitter) {
+		e.TimeFormat = format
+	}
+}
+
+// WithLevelFormat sets how levels are spelled
+func WithLevelFormat(format LevelFormat) Option {
+	return func(e *Emitter) {
+		e.LevelFormat = format
+	}
+}
+
+// WithHook adds a hook, called after the hooks already configured
+func WithHook(hook Hook) Option {
+	return func(e *Emitter) {
+		if hook == nil {
+			return
+		}
+		if prev := e.Hook; prev != nil {
+			e.Hook = func(level Level, doc []byte) {
+				prev(level, doc)
+				hook(level, doc)
+			}
+			return
+		}
+		e.Hook = hook
+	}
+}
+
+// WithEntryHook adds an entry hook, called after the hooks already configured
+func WithEntryHook(hook EntryHook) Option {
+	return func(e *Emitter) {
+		hooks := make([]EntryHook, len(e.Hooks), len(e.Hooks)+1)
+		copy(hooks, e.Hooks)
+		e.Hooks = append(hooks, hook)
+	}
+}
+
+// WithEncoder sets how entries are rendered
+func WithEncoder(encoder Encoder) Option {
+	return func(e *Emitter) {
+		e.Encoder = encoder
+	}
+}
+
+// WithFields adds static fields to every entry, after the ones already configured
+func WithFields(fields ...interface{}) Option {
+	return func(e *Emitter) {
+		e.addFields(fields...)
+	}
+}
@@ -0,0 +1,69 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func TestNew(t *testing.T) {
+	sink := &bytes.Buffer{}
+	var hooked []string
+
+	e := log.New(
+		log.WithOutput(sink),
+		log.WithLevel(log.Debug),
+		log.WithTimeFormat(time.RFC3339),
+		log.WithHook(func(l log.Level, doc []byte) { hooked = append(hooked, "first") }),
+		log.WithHook(func(l log.Level, doc []byte) { hooked = append(hooked, "second") }),
+		log.WithFields("app", "test"),
+		log.WithFields("version", 2),
+	)
+	e.T("tag", "hidden")
+	e.D("tag", "shown", "a", 1)
+
+	got := make(map[string]interface{})
+	if err := json.Unmarshal(sink.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json logging: %s", sink.String())
+	}
+	if _, err := time.Parse(time.RFC3339, got["time"].(string)); err != nil {
+		t.Errorf("invalid time: %v", err)
+	}
+	delete(got, "time")
+
+	want := map[string]interface{}{
+		"tag":     "tag",
+		"level":   "debug",
+		"msg":     "shown",
+		"app":     "test",
+		"version": float64(2),
+		"a":       float64(1),
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\ngot: %v", want, got)
+	}
+	if !reflect.DeepEqual(hooked, []string{"first", "second"}) {
+		t.Errorf("hooks were not chained: %v", hooked)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	sink := &bytes.Buffer{}
+	log.SetTestMode(true, sink)
+	defer log.SetTestMode(false)
+
+	log.Configure(log.WithLevel(log.Warn), log.WithFields("app", "test"))
+	log.Configure(log.WithLevelFormat(log.LevelUpper))
+
+	log.I("tag", "hidden")
+	log.C("tag", "a", 1).W("shown")
+
+	want := `{"tag":"tag","level":"WARN","msg":"shown","app":"test","a":1}` + "\n"
+	if got := sink.String(); got != want {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+}
@@ -0,0 +1,252 @@
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields holding the trace context of an entry, as hex strings or byte arrays,
+// which exporters and encoders map to the convention of their platform.
+const (
+	TraceIDField = "trace_id"
+	SpanIDField  = "span_id"
+)
+
+// OTLPOptions configures NewOTLP
+type OTLPOptions struct {
+	// HTTP configures the batching and the retries of the requests, see HTTPOutput.
+	// The URL is http://localhost:4318/v1/logs when empty and the format is ignored.
+	HTTP HTTPOptions
+
+	// Resource are the attributes of the resource as key value pairs, like "service.name", "api".
+	// The service name is unknown_service followed by the executable name when missing.
+	Resource []interface{}
+
+	// Scope is the name of the instrumentation scope, github.com/bemobi/log when empty
+	Scope string
+}
+
+// NewOTLP returns an HTTPOutput exporting the entries to an OpenTelemetry collector,
+// with the OTLP/HTTP protocol and the JSON encoding.
+//
+// Entries are mapped to the OpenTelemetry log data model: the message is the body, the level
+// gives the severity number and text, and the fields and the tag are attributes,
+// except the TraceIDField and SpanIDField fields setting the trace context.
+//
+// Trace, Debug, Info, Warn and Error are the TRACE, DEBUG, INFO, WARN and ERROR severities,
+// and Panic and Fatal, which OpenTelemetry has no names for, are FATAL (21) and FATAL4 (24),
+// so Fatal entries rank above Panic ones. Integers beyond the int64 range are sent as strings.
+func NewOTLP(options OTLPOptions) *HTTPOutput {
+	if options.HTTP.URL == "" {
+		options.HTTP.URL = "http://localhost:4318/v1/logs"
+	}
+	if options.Scope == "" {
+		options.Scope = "github.com/bemobi/log"
+	}
+
+	resource := options.Resource
+	hasService := false
+	for i := 0; i+1 < len(resource); i += 2 {
+		hasService = hasService || keyString(resource[i]) == "service.name"
+	}
+	if !hasService {
+		resource = append(resource[:len(resource):len(resource)], "service.name", "unknown_service:"+filepath.Base(os.Args[0]))
+	}
+
+	var header bytes.Buffer
+	header.WriteString(`{"resourceLogs":[{"resource":{"attributes":[`)
+	writeOTLPAttributes(&header, resource)
+	header.WriteString(`]},"scopeLogs":[{"scope":{"name":`)
+	writeJSONString(&header, options.Scope)
+	header.WriteString(`},"logRecords":[`)
+
+	return newHTTPOutput(options.HTTP, otlpFormat{header: header.Bytes()})
+}
+
+// otlpFormat renders the batches as ExportLogsServiceRequest messages
+type otlpFormat struct {
+	header []byte
+}
+
+func (otlpFormat) contentType() string {
+	return "application/json"
+}
+
+// encode renders the log record
+func (otlpFormat) encode(e *Emitter, entry *Entry) []byte {
+	var buf bytes.Buffer
+	writeOTLPRecord(&buf, entry.Time, entry.Level, entry.Message)
+
+	var traceID, spanID string
+	attributes := make([]interface{}, 0, 2+len(e.fields)+len(entry.Fields))
+	if entry.Tag != "" {
+		attributes = append(attributes, "tag", entry.Tag)
+	}
+	for _, fields := range [2][]interface{}{e.fields, entry.Fields} {
+		for i := 0; i+1 < len(fields); i += 2 {
+			switch keyString(fields[i]) {
+			case TraceIDField:
+				if traceID = traceContextID(fields[i+1], 16); traceID != "" {
+					continue
+				}
+			case SpanIDField:
+				if spanID = traceContextID(fields[i+1], 8); spanID != "" {
+					continue
+				}
+			}
+			attributes = append(attributes, fields[i], fields[i+1])
+		}
+	}
+
+	buf.WriteString(`,"attributes":[`)
+	writeOTLPAttributes(&buf, attributes)
+	buf.WriteByte(']')
+
+	if traceID != "" {
+		buf.WriteString(`,"traceId":"`)
+		buf.WriteString(traceID)
+		buf.WriteByte('"')
+	}
+	if spanID != "" {
+		buf.WriteString(`,"spanId":"`)
+		buf.WriteString(spanID)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// raw renders the document as the body of an Info record
+func (otlpFormat) raw(p []byte) []byte {
+	var buf bytes.Buffer
+	writeOTLPRecord(&buf, time.Now(), Info, string(bytes.TrimRight(p, "\n")))
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+func (f otlpFormat) body(buf *bytes.Buffer, batch []httpEntry) {
+	buf.Write(f.header)
+	for i, entry := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(entry.doc)
+	}
+	buf.WriteString(`]}]}]}`)
+}
+
+// writeOTLPRecord writes the start of a log record, up to its body
+func writeOTLPRecord(buf *bytes.Buffer, t time.Time, level Level, message string) {
+	ns := strconv.FormatInt(t.UnixNano(), 10)
+	buf.WriteString(`{"timeUnixNano":"`)
+	buf.WriteString(ns)
+	buf.WriteString(`","observedTimeUnixNano":"`)
+	buf.WriteString(ns)
+	buf.WriteString(`","severityNumber":`)
+	buf.WriteString(strconv.Itoa(otlpSeverity(level)))
+	buf.WriteString(`,"severityText":`)
+	writeJSONString(buf, strings.ToUpper(level.String()))
+	buf.WriteString(`,"body":{"stringValue":`)
+	writeJSONString(buf, message)
+	buf.WriteByte('}')
+}
+
+// otlpSeverities are the severity numbers of the levels, by tens: Trace is TRACE (1), Debug DEBUG (5),
+// Info INFO (9), Warn WARN (13), Error ERROR (17), Panic FATAL (21) and Fatal FATAL4 (24)
+var otlpSeverities = [...]int{1, 1, 5, 9, 13, 17, 21, 24}
+
+// otlpSeverity returns the OpenTelemetry severity number of the level.
+// Levels between the predefined ones take the numbers between theirs.
+func otlpSeverity(level Level) int {
+	band := int(level) / 10
+	if band >= len(otlpSeverities)-1 {
+		return otlpSeverities[len(otlpSeverities)-1]
+	}
+	if band == 0 {
+		return otlpSeverities[1]
+	}
+	base, next := otlpSeverities[band], otlpSeverities[band+1]
+	return base + int(level)%10*(next-base)/10
+}
+
+// writeOTLPAttributes writes the fields as key values
+func writeOTLPAttributes(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key := keyString(fields[i])
+		buf.WriteString(`{"key":`)
+		writeJSONString(buf, key)
+		buf.WriteString(`,"value":{`)
+		switch val := fields[i+1].(type) {
+		case bool:
+			buf.WriteString(`"boolValue":`)
+			buf.WriteString(strconv.FormatBool(val))
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+			// 64 bits integers are strings in the JSON encoding of protobuf
+			buf.WriteString(`"intValue":"`)
+			buf.WriteString(valueString(val))
+			buf.WriteByte('"')
+		case uint64:
+			if val > math.MaxInt64 {
+				buf.WriteString(`"stringValue":`)
+				writeJSONString(buf, strconv.FormatUint(val, 10))
+				break
+			}
+			buf.WriteString(`"intValue":"`)
+			buf.WriteString(strconv.FormatUint(val, 10))
+			buf.WriteByte('"')
+		case float32:
+			writeOTLPDouble(buf, float64(val), 32)
+		case float64:
+			writeOTLPDouble(buf, val, 64)
+		default:
+			buf.WriteString(`"stringValue":`)
+			writeJSONString(buf, valueString(val))
+		}
+		buf.WriteString(`}}`)
+	}
+}
+
+// writeOTLPDouble writes the number, as a string when JSON cannot represent it
+func writeOTLPDouble(buf *bytes.Buffer, val float64, bitSize int) {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		buf.WriteString(`"stringValue":`)
+		writeJSONString(buf, strconv.FormatFloat(val, 'g', -1, bitSize))
+		return
+	}
+	buf.WriteString(`"doubleValue":`)
+	buf.WriteString(strconv.FormatFloat(val, 'g', -1, bitSize))
+}
+
+// traceContextID returns the id as a lower case hex string of the size in bytes, empty when invalid
+func traceContextID(value interface{}, size int) string {
+	var id []byte
+	switch val := value.(type) {
+	case string:
+		if b, err := hex.DecodeString(val); err == nil {
+			id = b
+		}
+	case []byte:
+		id = val
+	case [16]byte:
+		id = val[:]
+	case [8]byte:
+		id = val[:]
+	default:
+		if b, err := hex.DecodeString(valueString(val)); err == nil {
+			id = b
+		}
+	}
+	if len(id) != size || bytes.Count(id, []byte{0}) == size {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,183 @@
+package log_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue"`
+	IntValue    *string  `json:"intValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+	BoolValue   *bool    `json:"boolValue"`
+}
+
+func (v otlpValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return "string:" + *v.StringValue
+	case v.IntValue != nil:
+		return "int:" + *v.IntValue
+	case v.DoubleValue != nil:
+		b, _ := json.Marshal(*v.DoubleValue)
+		return "double:" + string(b)
+	case v.BoolValue != nil:
+		b, _ := json.Marshal(*v.BoolValue)
+		return "bool:" + string(b)
+	}
+	return "none"
+}
+
+type otlpAttributes []struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func (a otlpAttributes) String() string {
+	s := ""
+	for i, attr := range a {
+		if i > 0 {
+			s += " "
+		}
+		s += attr.Key + "=" + attr.Value.String()
+	}
+	return s
+}
+
+type otlpRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes otlpAttributes `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano   string         `json:"timeUnixNano"`
+				SeverityNumber int            `json:"severityNumber"`
+				SeverityText   string         `json:"severityText"`
+				Body           otlpValue      `json:"body"`
+				Attributes     otlpAttributes `json:"attributes"`
+				TraceID        string         `json:"traceId"`
+				SpanID         string         `json:"spanId"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+func TestOTLP(t *testing.T) {
+	collector := newHTTPServer()
+	defer collector.Close()
+
+	out := log.NewOTLP(log.OTLPOptions{
+		HTTP:     log.HTTPOptions{URL: collector.URL + "/v1/logs"},
+		Resource: []interface{}{"service.name", "api", "service.version", "1.2"},
+	})
+	e := log.New(log.WithOutput(out), log.WithLevel(log.Trace), log.WithFields("trace_id", "4BF92F3577B34DA6A3CE929D0E0E4736"))
+	e.W("http", "slow request", "span_id", "00f067aa0ba902b7", "status", 200, "duration", 1.5, "retried", true, "path", "/users",
+		"bytes", uint64(1<<40), "hash", uint64(math.MaxUint64))
+	e.T("", "trace")
+	e.E("db", "invalid span", "span_id", "nope")
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := collector.received()
+	if len(bodies) != 1 {
+		t.Fatalf("invalid requests: %q", bodies)
+	}
+	if header := collector.headers[0].Get("Content-Type"); header != "application/json" {
+		t.Errorf("invalid content type: %s", header)
+	}
+	var req otlpRequest
+	if err := json.Unmarshal([]byte(bodies[0]), &req); err != nil {
+		t.Fatalf("invalid body %s: %v", bodies[0], err)
+	}
+
+	resource := req.ResourceLogs[0]
+	if got := resource.Resource.Attributes.String(); got != "service.name=string:api service.version=string:1.2" {
+		t.Errorf("invalid resource: %s", got)
+	}
+	scope := resource.ScopeLogs[0]
+	if scope.Scope.Name != "github.com/bemobi/log" || len(scope.LogRecords) != 3 {
+		t.Fatalf("invalid scope logs: %+v", scope)
+	}
+
+	want := []struct {
+		severity   int
+		text       string
+		body       string
+		attributes string
+		traceID    string
+		spanID     string
+	}{
+		{13, "WARN", "string:slow request", "tag=string:http status=int:200 duration=double:1.5 retried=bool:true path=string:/users" +
+			" bytes=int:1099511627776 hash=string:18446744073709551615",
+			"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{1, "TRACE", "string:trace", "", "4bf92f3577b34da6a3ce929d0e0e4736", ""},
+		{17, "ERROR", "string:invalid span", "tag=string:db span_id=string:nope", "4bf92f3577b34da6a3ce929d0e0e4736", ""},
+	}
+	for i, record := range scope.LogRecords {
+		w := want[i]
+		if record.SeverityNumber != w.severity || record.SeverityText != w.text || record.Body.String() != w.body ||
+			record.Attributes.String() != w.attributes || record.TraceID != w.traceID || record.SpanID != w.spanID {
+			t.Errorf("invalid record %d: %+v", i, record)
+		}
+		if len(record.TimeUnixNano) < 19 {
+			t.Errorf("invalid time: %s", record.TimeUnixNano)
+		}
+	}
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	const notice = log.Info + 5
+	if err := log.RegisterLevel(notice, "notice", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := newHTTPServer()
+	defer collector.Close()
+
+	out := log.NewOTLP(log.OTLPOptions{HTTP: log.HTTPOptions{URL: collector.URL}})
+	e := log.New(log.WithOutput(out), log.WithLevel(log.Trace))
+	for _, level := range []log.Level{log.Debug, log.Info, notice, log.Panic, log.Fatal} {
+		e.Emit("", level, "entry")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal([]byte(collector.received()[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	var texts []string
+	for _, record := range req.ResourceLogs[0].ScopeLogs[0].LogRecords {
+		got = append(got, record.SeverityNumber)
+		texts = append(texts, record.SeverityText)
+	}
+	// Panic and Fatal are FATAL and FATAL4
+	want := []int{5, 9, 11, 21, 24}
+	if len(got) != len(want) {
+		t.Fatalf("invalid severities: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("invalid severities: want %v, got %v, %v", want, got, texts)
+			break
+		}
+	}
+	if texts[2] != "NOTICE" || texts[3] != "PANIC" || texts[4] != "FATAL" {
+		t.Errorf("invalid severity texts: %v", texts)
+	}
+
+	attrs := req.ResourceLogs[0].Resource.Attributes
+	if len(attrs) != 1 || attrs[0].Key != "service.name" || len(*attrs[0].Value.StringValue) <= len("unknown_service:") {
+		t.Errorf("invalid resource: %s", attrs)
+	}
+}
@@ -0,0 +1,223 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoOutput is reported when an emitter has no output
+var ErrNoOutput = errors.New("log: no output")
+
+// writeErrorInterval limits how often write errors are written to os.Stderr
+const writeErrorInterval = 10 * time.Second
+
+// WriteStats counts the entries the output failed to write
+type WriteStats struct {
+	// Failed is how many entries the output failed to write
+	Failed uint64
+
+	// FellBack is how many of those were written to the fallback output
+	FellBack uint64
+
+	// Lost is how many of those were not written anywhere
+	Lost uint64
+
+	// Partial is how many of those some outputs of a Tee or a Router wrote,
+	// which are not written to the fallback output so they are not duplicated
+	Partial uint64
+}
+
+type writeStats struct {
+	failed, fellBack, lost, partial uint64
+
+	mu         sync.Mutex
+	reported   time.Time
+	suppressed int
+}
+
+// orphanStats counts the write errors of emitters not created by New
+var orphanStats writeStats
+
+func (e *Emitter) writeStats() *writeStats {
+	if e.shared == nil {
+		return &orphanStats
+	}
+	return &e.shared.stats
+}
+
+// WriteStats returns the write failures of the emitter and of all the contexts derived from it
+func (e *Emitter) WriteStats() WriteStats {
+	stats := e.writeStats()
+	return WriteStats{
+		Failed:   atomic.LoadUint64(&stats.failed),
+		FellBack: atomic.LoadUint64(&stats.fellBack),
+		Lost:     atomic.LoadUint64(&stats.lost),
+		Partial:  atomic.LoadUint64(&stats.partial),
+	}
+}
+
+// WithFallback sets the writer receiving the entries the output fails to write, see Locked
+func WithFallback(fallback io.Writer) Option {
+	return func(e *Emitter) {
+		e.Fallback = Locked(fallback)
+	}
+}
+
+// WithWriteErrorHandler sets the function receiving the errors writing to the output
+func WithWriteErrorHandler(handler func(err error)) Option {
+	return func(e *Emitter) {
+		e.OnWriteError = handler
+	}
+}
+
+// writeFailed reports the error and tries the fallback output,
+// unless other outputs of a Tee or a Router wrote the entry
+func (e *Emitter) writeFailed(err error, doc []byte) {
+	stats := e.writeStats()
+	atomic.AddUint64(&stats.failed, 1)
+
+	if e.OnWriteError != nil {
+		e.OnWriteError(err)
+	} else {
+		stats.report(err)
+	}
+
+	var partial *partialWriteError
+	if errors.As(err, &partial) {
+		atomic.AddUint64(&stats.partial, 1)
+		return
+	}
+
+	if e.Fallback != nil && e.writeFallback(doc) == nil {
+		atomic.AddUint64(&stats.fellBack, 1)
+		return
+	}
+	atomic.AddUint64(&stats.lost, 1)
+}
+
+func (e *Emitter) writeFallback(doc []byte) error {
+	out := e.Fallback
+	if mu := e.outputLock(out); mu != nil {
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	_, err := out.Write(doc)
+	return err
+}
+
+// report writes the error to os.Stderr, unless another one was written recently
+func (s *writeStats) report(err error) {
+	s.mu.Lock()
+	now := time.Now()
+	if !s.reported.IsZero() && now.Sub(s.reported) < writeErrorInterval {
+		s.suppressed++
+		s.mu.Unlock()
+		return
+	}
+	suppressed := s.suppressed
+	s.reported, s.suppressed = now, 0
+	s.mu.Unlock()
+
+	if suppressed > 0 {
+		fmt.Fprintf(os.Stderr, "log: write failed: %v (%d more failures since the last report)\n", err, suppressed)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "log: write failed: %v\n", err)
+}
+
+// ConcurrentWriter is implemented by outputs safe for concurrent use,
+// which Locked leaves as they are when Concurrent returns true
+type ConcurrentWriter interface {
+	io.Writer
+	Concurrent() bool
+}
+
+// Locked wraps the writer with a mutex, so concurrent writes are never interleaved.
+// The writer returned is still an EntryWriter when w is one.
+//
+// Writers safe for concurrent use are returned as they are: files, ioutil.Discard,
+// ConcurrentWriter implementations, and writers already locked.
+// The options setting outputs lock them, so emitters and the contexts derived from them share the lock.
+// Emitters created separately only share a lock when they share the locked writer.
+func Locked(w io.Writer) io.Writer {
+	if w == nil || isConcurrent(w) {
+		return w
+	}
+	if _, ok := w.(EntryWriter); ok {
+		return &lockedEntryWriter{lockedWriter{w: w}}
+	}
+	return &lockedWriter{w: w}
+}
+
+// orphanOutputMu serializes the writes to unlocked outputs of emitters not created by New
+var orphanOutputMu sync.Mutex
+
+// outputLock returns the mutex serializing the writes to an output assigned to the Output field
+// without being locked, which the emitter shares with the contexts derived from it,
+// or nil when the output is safe for concurrent use
+func (e *Emitter) outputLock(out io.Writer) *sync.Mutex {
+	if out == nil || isConcurrent(out) {
+		return nil
+	}
+	if e.shared == nil {
+		return &orphanOutputMu
+	}
+	return &e.shared.outputMu
+}
+
+func isConcurrent(w io.Writer) bool {
+	switch out := w.(type) {
+	case *os.File, *lockedWriter, *lockedEntryWriter:
+		// writes to files are serialized by the runtime, and each entry is a single write
+		return true
+	case ConcurrentWriter:
+		return out.Concurrent()
+	}
+	return w == ioutil.Discard
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Sync flushes the writer, see Emitter.Sync
+func (l *lockedWriter) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return syncValue(l.w)
+}
+
+// Close closes the writer, see Emitter.Close
+func (l *lockedWriter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if isStdStream(l.w) {
+		return nil
+	}
+	return closeValue(l.w)
+}
+
+// lockedEntryWriter is a locked EntryWriter
+type lockedEntryWriter struct {
+	lockedWriter
+}
+
+// WriteEntry implements EntryWriter
+func (l *lockedEntryWriter) WriteEntry(e *Emitter, entry *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.(EntryWriter).WriteEntry(e, entry)
+}
@@ -0,0 +1,255 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func TestWriteErrors(t *testing.T) {
+	fallback := &bytes.Buffer{}
+	var errs []error
+
+	e := log.New(
+		log.WithOutput(failingWriter{}),
+		log.WithFallback(fallback),
+		log.WithWriteErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	logger := &log.Context{Emitter: e, Tag: "test"}
+	logger.C("a", 1).I("one")
+	logger.I("two")
+
+	want := `{"tag":"test","level":"info","msg":"one","a":1}` + "\n" + `{"tag":"test","level":"info","msg":"two"}` + "\n"
+	if got := fallback.String(); got != want {
+		t.Errorf("invalid fallback output:\nwant: %s\ngot: %s", want, got)
+	}
+	if len(errs) != 2 || errs[0].Error() != "broken pipe" {
+		t.Errorf("invalid errors: %v", errs)
+	}
+
+	e.Fallback = failingWriter{}
+	e.I("test", "three")
+
+	e.Output, e.Fallback = nil, nil
+	e.I("test", "four")
+	if errs[3] != log.ErrNoOutput {
+		t.Errorf("invalid error: %v", errs[3])
+	}
+
+	stats := e.WriteStats()
+	if want := (log.WriteStats{Failed: 4, FellBack: 2, Lost: 2}); stats != want {
+		t.Errorf("invalid stats:\nwant: %+v\ngot: %+v", want, stats)
+	}
+}
+
+func TestWriteErrorsPartial(t *testing.T) {
+	fallback, written := &bytes.Buffer{}, &bytes.Buffer{}
+	var errs []error
+	e := log.New(
+		log.WithOutput(log.NewTee(
+			log.TeeOutput{Output: failingWriter{}},
+			log.TeeOutput{Output: written},
+			log.TeeOutput{Output: failingWriter{}, Level: log.Error},
+		)),
+		log.WithFallback(fallback),
+		log.WithWriteErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	e.I("test", "one")
+	e.E("test", "two")
+
+	if got := strings.Count(written.String(), "\n"); got != 2 {
+		t.Errorf("invalid output: %s", written.String())
+	}
+	if fallback.Len() > 0 {
+		t.Errorf("written entries were duplicated to the fallback: %s", fallback.String())
+	}
+	if len(errs) != 2 {
+		t.Errorf("invalid errors: %v", errs)
+	}
+	if want := (log.WriteStats{Failed: 2, Partial: 2}); e.WriteStats() != want {
+		t.Errorf("invalid stats:\nwant: %+v\ngot: %+v", want, e.WriteStats())
+	}
+}
+
+func TestWriteErrorsEntryWriter(t *testing.T) {
+	fallback := &bytes.Buffer{}
+	e := log.New(
+		log.WithOutput(log.NewTee(log.TeeOutput{Output: failingWriter{}})),
+		log.WithFallback(fallback),
+		log.WithWriteErrorHandler(func(err error) {}),
+	)
+	e.I("test", "one")
+
+	if want := `{"tag":"test","level":"info","msg":"one"}` + "\n"; fallback.String() != want {
+		t.Errorf("invalid fallback output:\nwant: %s\ngot: %s", want, fallback.String())
+	}
+}
+
+func TestWriteErrorsReport(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	e := log.New(log.WithOutput(failingWriter{}))
+	for i := 0; i < 10; i++ {
+		e.I("test", "lost")
+	}
+
+	w.Close()
+	os.Stderr = stderr
+	out, _ := ioutil.ReadAll(r)
+
+	if got := strings.Count(string(out), "log: write failed: broken pipe"); got != 1 {
+		t.Errorf("write errors were not rate limited: %s", out)
+	}
+	if stats := e.WriteStats(); stats.Lost != 10 {
+		t.Errorf("invalid stats: %+v", stats)
+	}
+}
+
+// splitWriter writes byte by byte, which interleaves concurrent writes when not locked
+type splitWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.buf.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+func TestLockedOutput(t *testing.T) {
+	out := &splitWriter{}
+	e := log.New(log.WithOutput(out), log.WithFields("pad", strings.Repeat("x", 256)))
+	shared := log.New(log.WithOutput(e.Output))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logger := &log.Context{Emitter: e, Tag: "test"}
+			if i%2 == 0 {
+				logger.Emitter = shared
+			}
+			logger = logger.C("worker", i)
+			for j := 0; j < 100; j++ {
+				logger.I("message", "n", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := 0
+	scanner := bufio.NewScanner(&out.buf)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines++
+		if !json.Valid(scanner.Bytes()) {
+			t.Fatalf("interleaved line: %s", scanner.Text())
+		}
+	}
+	if lines != 1600 {
+		t.Errorf("invalid line count: %d", lines)
+	}
+}
+
+func TestLockedOutputAssigned(t *testing.T) {
+	out := &splitWriter{}
+	e := log.New(log.WithFields("pad", strings.Repeat("x", 256)))
+	e.Output = out
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logger := (&log.Context{Emitter: e, Tag: "test"}).C("worker", i)
+			for j := 0; j < 100; j++ {
+				logger.I("message", "n", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	scanner := bufio.NewScanner(&out.buf)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if !json.Valid(scanner.Bytes()) {
+			t.Fatalf("interleaved line: %s", scanner.Text())
+		}
+	}
+}
+
+// messageWriter is an EntryWriter keeping the messages, not safe for concurrent use
+type messageWriter struct {
+	messages []string
+}
+
+func (m *messageWriter) Write(p []byte) (int, error) {
+	m.messages = append(m.messages, string(p))
+	return len(p), nil
+}
+
+func (m *messageWriter) WriteEntry(e *log.Emitter, entry *log.Entry) error {
+	m.messages = append(m.messages, entry.Message)
+	return nil
+}
+
+func TestLockedEntryWriter(t *testing.T) {
+	out := &messageWriter{}
+	locked := log.Locked(out)
+	if _, ok := locked.(log.EntryWriter); !ok || locked == io.Writer(out) {
+		t.Fatalf("invalid locked writer: %T", locked)
+	}
+
+	e := log.New(log.WithOutput(out))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.I("test", "entry")
+			}
+		}()
+	}
+	wg.Wait()
+	if len(out.messages) != 800 || out.messages[0] != "entry" {
+		t.Errorf("invalid messages: %d", len(out.messages))
+	}
+}
+
+func TestLocked(t *testing.T) {
+	out := &splitWriter{}
+	locked := log.Locked(out)
+	if locked == io.Writer(out) {
+		t.Error("writer was not locked")
+	}
+	if log.Locked(locked) != locked {
+		t.Error("locked writer was locked twice")
+	}
+	if log.Locked(os.Stderr) != io.Writer(os.Stderr) {
+		t.Error("file was locked")
+	}
+	if log.Locked(ioutil.Discard) != ioutil.Discard {
+		t.Error("discard was locked")
+	}
+	tee := log.NewTee(log.TeeOutput{Output: out})
+	if log.Locked(tee) != io.Writer(tee) {
+		t.Error("tee was locked")
+	}
+}
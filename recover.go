@@ -0,0 +1,111 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// RecoverPolicy tells what happens after a recovered panic is logged
+type RecoverPolicy byte
+
+const (
+	// RecoverSwallow logs the panic as an Error and lets the goroutine go on normally
+	RecoverSwallow RecoverPolicy = iota
+
+	// RecoverRepanic logs the panic as an Error and panics again with the same value
+	RecoverRepanic
+
+	// RecoverExit logs the panic as Fatal and halts the application like F does
+	RecoverExit
+)
+
+// maxStackFrames limits the stack logged with a recovered panic
+const maxStackFrames = 32
+
+// Recover recovers a panic and logs it with the panic value, its type and the stack.
+// It must be deferred directly, otherwise there is nothing to recover:
+//
+//	defer logger.Recover(log.RecoverSwallow)
+func (c *Context) Recover(policy RecoverPolicy) {
+	if r := recover(); r != nil {
+		c.Emitter.recovered(c.Tag, policy, r)
+	}
+}
+
+// Go runs fn in a new goroutine which recovers panics with the given policy
+func (c *Context) Go(policy RecoverPolicy, fn func()) {
+	go func() {
+		defer c.Recover(policy)
+		fn()
+	}()
+}
+
+// Recover recovers a panic and logs it with the panic value, its type and the stack.
+// It must be deferred directly, otherwise there is nothing to recover:
+//
+//	defer log.Default.Recover("TAG", log.RecoverSwallow)
+func (e *Emitter) Recover(tag string, policy RecoverPolicy) {
+	if r := recover(); r != nil {
+		e.recovered(tag, policy, r)
+	}
+}
+
+// Go runs fn in a new goroutine which recovers panics with the given policy
+func (e *Emitter) Go(tag string, policy RecoverPolicy, fn func()) {
+	go func() {
+		defer e.Recover(tag, policy)
+		fn()
+	}()
+}
+
+func (e *Emitter) recovered(tag string, policy RecoverPolicy, r interface{}) {
+	level := Error
+	if policy == RecoverExit {
+		level = Fatal
+	}
+	e.Emit(tag, level, "recovered panic",
+		"panic", r,
+		"panic_type", fmt.Sprintf("%T", r),
+		"stack", panicStack(),
+	)
+
+	switch policy {
+	case RecoverRepanic:
+		panic(r)
+	case RecoverExit:
+		e.exit()
+	}
+}
+
+// panicStack returns the stack of the panicking goroutine, starting at the function that panicked
+func panicStack() string {
+	pc := make([]uintptr, maxStackFrames+16)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(1, pc)])
+
+	var b strings.Builder
+	panicking, count := false, 0
+	for count < maxStackFrames {
+		frame, more := frames.Next()
+		if !panicking {
+			// everything up to the runtime panic handling belongs to the recovery itself
+			panicking = frame.Function == "runtime.gopanic"
+		} else if !strings.HasPrefix(frame.Function, "runtime.") {
+			if count > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(frame.Function)
+			b.WriteString(" (")
+			b.WriteString(frame.File)
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(frame.Line))
+			b.WriteByte(')')
+			count++
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
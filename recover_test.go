@@ -0,0 +1,87 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func explode() {
+	panic("kaboom")
+}
+
+func TestRecover(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Policy   log.RecoverPolicy
+		Level    string
+		Repanic  bool
+		ExitCode int
+	}{
+		{Name: "Swallow", Policy: log.RecoverSwallow, Level: "error"},
+		{Name: "Repanic", Policy: log.RecoverRepanic, Level: "error", Repanic: true},
+		{Name: "Exit", Policy: log.RecoverExit, Level: "fatal", ExitCode: 1},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			sink := &bytes.Buffer{}
+			exitCode := 0
+			logger := &log.Context{
+				Emitter: &log.Emitter{Output: sink, Exit: func(code int) { exitCode = code }},
+				Tag:     "test",
+			}
+
+			var repanic interface{}
+			func() {
+				defer func() { repanic = recover() }()
+				func() {
+					defer logger.Recover(tc.Policy)
+					explode()
+				}()
+			}()
+
+			if tc.Repanic && repanic != "kaboom" {
+				t.Errorf("invalid panic value:\nwant: kaboom\ngot: %v", repanic)
+			}
+			if !tc.Repanic && repanic != nil {
+				t.Errorf("unexpected panic: %v", repanic)
+			}
+			if exitCode != tc.ExitCode {
+				t.Errorf("invalid exit code:\nwant: %d\ngot: %d", tc.ExitCode, exitCode)
+			}
+
+			got := make(map[string]interface{})
+			if err := json.Unmarshal(sink.Bytes(), &got); err != nil {
+				t.Fatalf("invalid json logging: %s", sink.String())
+			}
+			if got["level"] != tc.Level || got["panic"] != "kaboom" || got["panic_type"] != "string" {
+				t.Errorf("invalid output: %v", got)
+			}
+			stack, _ := got["stack"].(string)
+			if !strings.HasPrefix(stack, "github.com/bemobi/log_test.explode (") {
+				t.Errorf("stack does not start at the panicking function:\n%s", stack)
+			}
+		})
+	}
+}
+
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestGo(t *testing.T) {
+	sink := make(chanWriter, 1)
+	logger := &log.Context{Emitter: &log.Emitter{Output: sink}, Tag: "test"}
+
+	logger.Go(log.RecoverSwallow, explode)
+
+	got := <-sink
+	if want := `"msg":"recovered panic","panic":"kaboom"`; !strings.Contains(got, want) {
+		t.Errorf("invalid output:\nwant: %s\ngot: %s", want, got)
+	}
+}
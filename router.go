@@ -0,0 +1,115 @@
+package log
+
+import (
+	"io"
+)
+
+// Route sends the entries matching all its conditions to an output
+type Route struct {
+	// Tag is the tag matched, any tag when empty
+	Tag string
+
+	// Level is the minimum level matched
+	Level Level
+
+	// Fields are the values matched by key, compared with the text form of the entry fields,
+	// including the context ones
+	Fields map[string]string
+
+	Output io.Writer
+
+	// Encoder renders the entries for the output, the emitter encoder when nil
+	Encoder Encoder
+}
+
+func (r *Route) match(entry *Entry) bool {
+	if r.Tag != "" && r.Tag != entry.Tag {
+		return false
+	}
+	if entry.Level < r.Level {
+		return false
+	}
+	for key, want := range r.Fields {
+		value, ok := entry.Get(key)
+		if !ok || valueString(value) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// RouteMode tells how many routes an entry takes
+type RouteMode byte
+
+const (
+	// RouteFirst sends each entry through the first matching route only
+	RouteFirst RouteMode = iota
+
+	// RouteAll sends each entry through every matching route
+	RouteAll
+)
+
+// Router is an output sending entries to other outputs, following ordered rules on tag, level and fields.
+// Entries matching no route go to the default output, which may be nil to drop them.
+//
+// The common use case is
+//
+//	router := log.NewRouter(log.RouteFirst, os.Stdout,
+//		log.Route{Tag: "audit", Output: auditFile},
+//		log.Route{Fields: map[string]string{"tenant": "acme"}, Output: acmeStream},
+//	)
+//	log.Configure(log.WithOutput(router))
+//
+// Like in a Tee, failing outputs do not prevent the others from being written.
+type Router struct {
+	outputSet
+	routes []Route
+	mode   RouteMode
+}
+
+// NewRouter returns a router with the given mode, default output and routes
+func NewRouter(mode RouteMode, fallback io.Writer, routes ...Route) *Router {
+	outputs := make([]TeeOutput, 0, len(routes)+1)
+	for _, route := range routes {
+		outputs = append(outputs, TeeOutput{Output: route.Output, Encoder: route.Encoder})
+	}
+	if fallback != nil {
+		outputs = append(outputs, TeeOutput{Output: fallback})
+	}
+	return &Router{outputSet: newOutputSet(outputs), routes: routes, mode: mode}
+}
+
+// WriteEntry implements EntryWriter
+func (r *Router) WriteEntry(e *Emitter, entry *Entry) error {
+	var buf [16]bool
+	matched := buf[:]
+	if len(r.outputs) > len(buf) {
+		matched = make([]bool, len(r.outputs))
+	}
+
+	any := false
+	for i := range r.routes {
+		if r.routes[i].match(entry) {
+			matched[i], any = true, true
+			if r.mode == RouteFirst {
+				break
+			}
+		}
+	}
+	if !any {
+		if len(r.outputs) == len(r.routes) {
+			return nil
+		}
+		matched[len(r.routes)] = true
+	}
+
+	return r.writeEntry(e, entry, func(i int) bool { return matched[i] })
+}
+
+// Write implements io.Writer, sending the encoded entry to the default output only
+func (r *Router) Write(p []byte) (int, error) {
+	if len(r.outputs) == len(r.routes) {
+		return len(p), nil
+	}
+	return r.outputs[len(r.routes)].Output.Write(p)
+}
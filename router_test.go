@@ -0,0 +1,92 @@
+package log_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bemobi/log"
+)
+
+func TestRouter(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Mode     log.RouteMode
+		Fallback bool
+		Audit    string
+		Acme     string
+		Errors   string
+		Stdout   string
+	}{
+		{
+			Name:     "First Match",
+			Mode:     log.RouteFirst,
+			Fallback: true,
+			Audit:    "audit login\naudit failure\n",
+			Acme:     "http acme request\n",
+			Errors:   "http acme failure\n",
+			Stdout:   "http other request\n",
+		},
+		{
+			Name:     "All Matches",
+			Mode:     log.RouteAll,
+			Fallback: true,
+			Audit:    "audit login\naudit failure\n",
+			Acme:     "http acme request\nhttp acme failure\n",
+			Errors:   "audit failure\nhttp acme failure\n",
+			Stdout:   "http other request\n",
+		},
+		{
+			Name:   "Without Default",
+			Mode:   log.RouteFirst,
+			Audit:  "audit login\naudit failure\n",
+			Acme:   "http acme request\n",
+			Errors: "http acme failure\n",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			audit, acme, errs, stdout := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+			enc := &plainEncoder{}
+
+			var fallback io.Writer
+			if tc.Fallback {
+				fallback = stdout
+			}
+			router := log.NewRouter(tc.Mode, fallback,
+				log.Route{Tag: "audit", Output: audit, Encoder: enc},
+				log.Route{Level: log.Error, Fields: map[string]string{"tenant": "acme"}, Output: errs, Encoder: enc},
+				log.Route{Fields: map[string]string{"tenant": "acme"}, Output: acme, Encoder: enc},
+				log.Route{Level: log.Error, Output: errs, Encoder: enc},
+			)
+			e := log.New(log.WithOutput(router), log.WithEncoder(enc))
+
+			e.I("audit", "login")
+			e.E("audit", "failure")
+			acmeLogger := &log.Context{Emitter: e, Tag: "http"}
+			acmeLogger = acmeLogger.C("tenant", "acme")
+			acmeLogger.I("request")
+			acmeLogger.E("failure")
+			e.I("http", "other request", "tenant", "other")
+
+			for name, got := range map[string]*bytes.Buffer{"audit": audit, "acme": acme, "errors": errs, "stdout": stdout} {
+				want := map[string]string{"audit": tc.Audit, "acme": tc.Acme, "errors": tc.Errors, "stdout": tc.Stdout}[name]
+				if got.String() != want {
+					t.Errorf("invalid %s output:\nwant: %q\ngot: %q", name, want, got.String())
+				}
+			}
+		})
+	}
+}
+
+// plainEncoder writes the tag and message only, so outputs are easy to compare
+type plainEncoder struct{}
+
+func (*plainEncoder) Encode(buf *bytes.Buffer, e *log.Emitter, entry *log.Entry) {
+	buf.WriteString(entry.Tag)
+	buf.WriteByte(' ')
+	if tenant, ok := entry.Get("tenant"); ok && tenant == "acme" {
+		buf.WriteString("acme ")
+	}
+	buf.WriteString(entry.Message)
+	buf.WriteByte('\n')
+}
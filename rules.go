@@ -0,0 +1,194 @@
+package log
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// redacted replaces the values of redacted fields
+const redacted = "[REDACTED]"
+
+// shared holds the settings an emitter shares with every context derived from it,
+// so they can be changed atomically while logging
+type shared struct {
+	// first, so the counters are aligned for atomic operations on 32 bit platforms
+	stats writeStats
+
+	rules    atomic.Value // *rules
+	recorder atomic.Value // *recorder
+
+	// boost is the level forced on every tag plus one, or zero
+	boost int32
+
+	config configOutput
+
+	// outputMu serializes the writes to an output not safe for concurrent use, see outputLock
+	outputMu sync.Mutex
+}
+
+// rules overrides the emitter settings, each one only when set
+type rules struct {
+	level    Level
+	hasLevel bool
+	tags     map[string]Level
+	redact   map[string]bool
+	drop     *Filter
+	hasDrop  bool
+}
+
+func (e *Emitter) loadRules() *rules {
+	if e.shared == nil {
+		return nil
+	}
+	r, _ := e.shared.rules.Load().(*rules)
+	return r
+}
+
+func (e *Emitter) storeRules(r *rules) {
+	e.sharedState().rules.Store(r)
+}
+
+// sharedMu serializes the creation of the shared settings of emitters not created by New
+var sharedMu sync.Mutex
+
+// sharedState returns the shared settings, creating them for emitters not created by New.
+// They are created before deriving any context, so the contexts share them.
+func (e *Emitter) sharedState() *shared {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if e.shared == nil {
+		e.shared = &shared{}
+	}
+	return e.shared
+}
+
+// redaction returns the keys whose values are redacted
+func (e *Emitter) redaction() map[string]bool {
+	if r := e.loadRules(); r != nil && r.redact != nil {
+		return r.redact
+	}
+	return e.redact
+}
+
+// dropFilter returns the filter of entries to drop
+func (e *Emitter) dropFilter() *Filter {
+	if r := e.loadRules(); r != nil && r.hasDrop {
+		return r.drop
+	}
+	return e.Drop
+}
+
+// WithRedact replaces the values of the fields with the given keys by "[REDACTED]",
+// in addition to the keys already redacted
+func WithRedact(keys ...string) Option {
+	return func(e *Emitter) {
+		redact := make(map[string]bool, len(e.redact)+len(keys))
+		for k := range e.redact {
+			redact[k] = true
+		}
+		for _, k := range keys {
+			redact[k] = true
+		}
+		e.redact = redact
+	}
+}
+
+// redactFields returns the fields with the redacted values replaced, copying them only when needed
+func redactFields(redact map[string]bool, fields []interface{}) []interface{} {
+	var copied []interface{}
+	for field := 0; field+1 < len(fields); field += 2 {
+		if !redact[keyString(fields[field])] {
+			continue
+		}
+		if copied == nil {
+			copied = make([]interface{}, len(fields))
+			copy(copied, fields)
+		}
+		copied[field+1] = redacted
+	}
+	if copied == nil {
+		return fields
+	}
+	return copied
+}
+
+// redactedContext are the context fields redacted with a set of keys, rendered once
+type redactedContext struct {
+	redact  map[string]bool
+	fields  []interface{}
+	context []byte
+}
+
+// redactContext returns a copy of the emitter with the context fields redacted,
+// or the emitter itself when there is nothing to redact.
+// The redacted context is kept until the redacted keys change.
+func (e *Emitter) redactContext(redact map[string]bool) *Emitter {
+	if len(e.fields) == 0 {
+		return e
+	}
+	cached, _ := e.redactCache.Load().(*redactedContext)
+	if cached == nil || !sameKeys(cached.redact, redact) {
+		cached = &redactedContext{redact: redact}
+		if fields := redactFields(redact, e.fields); &fields[0] != &e.fields[0] {
+			var buf bytes.Buffer
+			writeFields(&buf, fields...)
+			cached.fields, cached.context = fields, buf.Bytes()
+		}
+		e.redactCache.Store(cached)
+	}
+	if cached.context == nil {
+		return e
+	}
+	copied := *e
+	copied.fields = cached.fields
+	copied.context = cached.context
+	return &copied
+}
+
+func sameKeys(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// recorder keeps copies of the most recent entries
+type recorder struct {
+	mu      sync.Mutex
+	entries [][]byte
+	next    int
+}
+
+func (r *recorder) add(entry []byte) {
+	r.mu.Lock()
+	r.entries[r.next] = append(r.entries[r.next][:0], entry...)
+	r.next = (r.next + 1) % len(r.entries)
+	r.mu.Unlock()
+}
+
+// recent returns the entries from the oldest to the newest
+func (r *recorder) recent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recent := make([]string, 0, len(r.entries))
+	for i := range r.entries {
+		if entry := r.entries[(r.next+i)%len(r.entries)]; len(entry) > 0 {
+			recent = append(recent, string(entry))
+		}
+	}
+	return recent
+}
+
+func (e *Emitter) loadRecorder() *recorder {
+	if e.shared == nil {
+		return nil
+	}
+	r, _ := e.shared.recorder.Load().(*recorder)
+	return r
+}
@@ -0,0 +1,153 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// SignalOptions configures InstallSignals. The zero value is ready to use.
+type SignalOptions struct {
+	// Verbose switches the level, SIGUSR1 when nil
+	Verbose os.Signal
+
+	// Restore switches the level back, SIGUSR2 when nil
+	Restore os.Signal
+
+	// Level is the level switched to, Trace when zero
+	Level Level
+
+	// Duration restores the level automatically, never when zero
+	Duration time.Duration
+
+	// Recent is how many recent entries are kept and dumped when switching, none when zero
+	Recent int
+
+	// Stacks dumps the stacks of all goroutines when switching
+	Stacks bool
+}
+
+// InstallSignals switches the Default emitter, and all the contexts derived from it,
+// to a verbose level when the process receives the Verbose signal, and back when it receives
+// the Restore signal or after Duration. The returned function uninstalls the handler.
+//
+// The common use case is
+//
+//	uninstall := log.InstallSignals(log.SignalOptions{Duration: 10 * time.Minute, Stacks: true})
+//	defer uninstall()
+//
+// And then, during an incident
+//
+//	kill -USR1 <pid>
+func InstallSignals(options SignalOptions) (uninstall func()) {
+	return Default.InstallSignals(options)
+}
+
+// InstallSignals switches the emitter, and all the contexts derived from it, to a verbose level
+// on signals. See the package level InstallSignals.
+func (e *Emitter) InstallSignals(options SignalOptions) (uninstall func()) {
+	if options.Verbose == nil {
+		options.Verbose = syscall.SIGUSR1
+	}
+	if options.Restore == nil {
+		options.Restore = syscall.SIGUSR2
+	}
+	if options.Level == 0 {
+		options.Level = Trace
+	}
+	e.sharedState()
+
+	var rec *recorder
+	if options.Recent > 0 {
+		rec = &recorder{entries: make([][]byte, options.Recent)}
+		e.shared.recorder.Store(rec)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, options.Verbose, options.Restore)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		for {
+			select {
+			case <-stop:
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case sig := <-signals:
+				if timer != nil {
+					timer.Stop()
+					timer, timeout = nil, nil
+				}
+				if sig == options.Restore {
+					e.restoreLevel("signal")
+					continue
+				}
+				// boosted first, so the diagnostics are emitted whatever the level
+				atomic.StoreInt32(&e.shared.boost, int32(options.Level)+1)
+				e.dump(rec, options.Stacks)
+				e.I("log", "verbose logging enabled", "verbose_level", options.Level.String(), "duration", options.Duration)
+				if options.Duration > 0 {
+					timer = time.NewTimer(options.Duration)
+					timeout = timer.C
+				}
+			case <-timeout:
+				timer, timeout = nil, nil
+				e.restoreLevel("timeout")
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(stop)
+			<-done
+			e.restoreLevel("uninstall")
+			if rec != nil {
+				e.shared.recorder.Store((*recorder)(nil))
+			}
+		})
+	}
+}
+
+// restoreLevel clears the boost after logging it, so the message is emitted whatever the level
+func (e *Emitter) restoreLevel(reason string) {
+	if atomic.LoadInt32(&e.shared.boost) != 0 {
+		e.I("log", "verbose logging disabled", "reason", reason)
+		atomic.StoreInt32(&e.shared.boost, 0)
+	}
+}
+
+// dump logs the recent entries and the goroutine stacks
+func (e *Emitter) dump(rec *recorder, stacks bool) {
+	if rec != nil {
+		e.I("log", "recent entries", "entries", strings.Join(rec.recent(), ""))
+	}
+	if stacks {
+		buf := make([]byte, 64<<10)
+		for {
+			n := runtime.Stack(buf, true)
+			if n < len(buf) {
+				buf = buf[:n]
+				break
+			}
+			buf = make([]byte, 2*len(buf))
+		}
+		e.I("log", "goroutine stacks", "stacks", buf)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log_test
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func TestInstallSignals(t *testing.T) {
+	sink := &syncBuffer{}
+	e := log.New(log.WithOutput(sink))
+	logger := &log.Context{Emitter: e, Tag: "test"}
+
+	uninstall := e.InstallSignals(log.SignalOptions{Recent: 2, Stacks: true})
+	defer uninstall()
+
+	logger.I("first")
+	logger.I("second")
+	logger.I("third")
+	logger.T("hidden")
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitFor(t, "verbose level", func() bool { return logger.Emitter.Enabled("test", log.Trace) })
+	waitFor(t, "dump", func() bool { return strings.Contains(sink.String(), "goroutine stacks") })
+
+	out := sink.String()
+	if strings.Contains(out, "hidden") {
+		t.Error("trace entry emitted before switching")
+	}
+	if !strings.Contains(out, `"msg":"recent entries","entries":"{\"tag\":\"test\",\"level\":\"info\",\"msg\":\"second\"}\n{\"tag\":\"test\",\"level\":\"info\",\"msg\":\"third\"}\n"`) {
+		t.Errorf("recent entries were not dumped: %s", out)
+	}
+	if !strings.Contains(out, "TestInstallSignals") {
+		t.Errorf("goroutine stacks were not dumped: %s", out)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	waitFor(t, "restored level", func() bool { return !e.Enabled("test", log.Trace) })
+
+	uninstall()
+	if !strings.Contains(sink.String(), `"msg":"verbose logging disabled","reason":"signal"`) {
+		t.Errorf("restore was not logged: %s", sink.String())
+	}
+}
+
+func TestInstallSignalsDuration(t *testing.T) {
+	sink := &syncBuffer{}
+	e := log.New(log.WithOutput(sink))
+
+	uninstall := e.InstallSignals(log.SignalOptions{Level: log.Debug, Duration: 20 * time.Millisecond})
+	defer uninstall()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitFor(t, "verbose level", func() bool { return e.Enabled("test", log.Debug) })
+	if e.Enabled("test", log.Trace) {
+		t.Error("switched to a lower level than asked")
+	}
+	waitFor(t, "restored level", func() bool { return !e.Enabled("test", log.Debug) })
+
+	if !strings.Contains(sink.String(), `"msg":"verbose logging disabled","reason":"timeout"`) {
+		t.Errorf("restore was not logged: %s", sink.String())
+	}
+}
+
+func TestInstallSignalsWarn(t *testing.T) {
+	sink := &syncBuffer{}
+	e := log.New(log.WithOutput(sink), log.WithLevel(log.Warn))
+
+	uninstall := e.InstallSignals(log.SignalOptions{Recent: 1, Stacks: true})
+	defer uninstall()
+
+	e.W("test", "slow")
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitFor(t, "dump", func() bool { return strings.Contains(sink.String(), "goroutine stacks") })
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	waitFor(t, "restored level", func() bool { return !e.Enabled("test", log.Info) })
+
+	uninstall()
+	for _, msg := range []string{"recent entries", "goroutine stacks", "verbose logging enabled", "verbose logging disabled"} {
+		if !strings.Contains(sink.String(), `"msg":"`+msg+`"`) {
+			t.Errorf("%q was filtered out: %s", msg, sink.String())
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// spoolExt is the extension of the segment files, named after their sequence number
+	spoolExt = ".spool"
+
+	// spoolCursor is the file keeping the position of the replay, a segment sequence number and an offset
+	spoolCursor = "cursor"
+
+	// spoolHeader is the size of the header preceding each entry, its length and its CRC-32
+	spoolHeader = 8
+)
+
+// SpoolOptions configures OpenSpool. The zero value is ready to use.
+type SpoolOptions struct {
+	// SegmentSize is the size of a segment file before a new one is started, 4 MiB when zero
+	SegmentSize int64
+
+	// MaxBytes bounds the size of the segments, 256 MiB when zero.
+	// The oldest segments are deleted to keep under it, dropping their entries.
+	MaxBytes int64
+
+	// RetryInterval is the time waited after the output fails before trying again, a second when zero
+	RetryInterval time.Duration
+
+	// OnError receives the errors writing to the output, which are written to os.Stderr
+	// at most once every ten seconds when nil
+	OnError func(err error)
+}
+
+// Spool is an output appending the encoded entries to segment files in a directory, and replaying them
+// in order to a network output from a background goroutine, so the entries survive the sink being
+// down for minutes and the process restarting.
+//
+// The common use case is
+//
+//	out, err := log.OpenSpool("/var/spool/app", gelf, log.SpoolOptions{MaxBytes: 1 << 30})
+//	if err != nil {
+//		log.F("spool", err.Error())
+//	}
+//	log.Configure(log.WithOutput(out), log.WithEncoder(log.GELFEncoder{}))
+//	defer log.Default.Close()
+//
+// The entries are written with the io.Writer interface of the output, one at a time, so the emitter
+// encoder must render what the output expects. Failing writes are retried every RetryInterval.
+//
+// The position of the replay is kept in a cursor file, so entries are delivered at least once:
+// the entry being written when the process dies is written again after the restart.
+type Spool struct {
+	// first, so the counters are aligned for atomic operations on 32 bit platforms
+	dropped uint64
+	stats   writeStats
+
+	dir     string
+	out     io.Writer
+	options SpoolOptions
+
+	mu      sync.Mutex
+	changed *sync.Cond
+
+	// segments are the segment files, oldest first, entries being appended to the last one
+	segments []spoolSegment
+	file     *os.File
+	cursor   *os.File
+	size     int64
+	record   []byte
+
+	// position of the replay in the oldest segment, and how many of its entries were delivered
+	offset    int64
+	delivered int
+
+	// entries appended, and entries delivered or dropped, since the spool was opened
+	appended uint64
+	handled  uint64
+
+	failures uint64
+	closed   bool
+
+	// outMu serializes the entries replayed to the output with its flushes
+	outMu sync.Mutex
+
+	// reader is the oldest segment, opened by the replay goroutine
+	reader    *os.File
+	readerSeq uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	records int
+}
+
+// OpenSpool opens the spool in the directory, creating it when missing, and starts replaying
+// the entries left by a previous process to the output
+func OpenSpool(dir string, output io.Writer, options SpoolOptions) (*Spool, error) {
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = 4 << 20
+	}
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 256 << 20
+	}
+	if options.SegmentSize > options.MaxBytes/2 {
+		options.SegmentSize = options.MaxBytes / 2
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = time.Second
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:     dir,
+		out:     output,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	if err := s.load(); err != nil {
+		if s.cursor != nil {
+			s.cursor.Close()
+		}
+		return nil, err
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// WriteEntry implements EntryWriter, appending the encoded entry to the spool
+func (s *Spool) WriteEntry(e *Emitter, entry *Entry) error {
+	buf := pool.Get().(*bytes.Buffer)
+	e.encoder().Encode(buf, e, entry)
+	err := s.append(buf.Bytes())
+	buf.Reset()
+	pool.Put(buf)
+	return err
+}
+
+// Write implements io.Writer, appending the document as it is to the spool
+func (s *Spool) Write(p []byte) (int, error) {
+	if err := s.append(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the segments are locked
+func (s *Spool) Concurrent() bool {
+	return true
+}
+
+// Dropped returns how many entries were dropped, evicted to keep under MaxBytes or unreadable
+func (s *Spool) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Pending returns how many entries wait to be written to the output
+func (s *Spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.appended - s.handled)
+}
+
+// Sync flushes the segment to disk, and waits until the entries written before the call are
+// written to the output or it fails, the entries then staying in the spool. It then flushes the output.
+func (s *Spool) Sync() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	err := s.file.Sync()
+	target, failures := s.appended, s.failures
+	for s.handled < target && s.failures == failures && !s.closed {
+		s.changed.Wait()
+	}
+	s.mu.Unlock()
+
+	s.outMu.Lock()
+	if serr := syncValue(s.out); err == nil {
+		err = serr
+	}
+	s.outMu.Unlock()
+	return err
+}
+
+// Close stops the replay, flushes the segment to disk and closes the output, unless it is
+// os.Stdout or os.Stderr. The entries not written yet are replayed when the spool is opened again.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.changed.Broadcast()
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := s.cursor.Close(); err == nil {
+		err = cerr
+	}
+	s.mu.Unlock()
+
+	if !isStdStream(s.out) {
+		s.outMu.Lock()
+		if cerr := closeValue(s.out); err == nil {
+			err = cerr
+		}
+		s.outMu.Unlock()
+	}
+	return err
+}
+
+// load scans the segments left by a previous process and starts a new one
+func (s *Spool) load() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolExt))
+	if err != nil {
+		return err
+	}
+	var seqs []uint64
+	for _, path := range paths {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), spoolExt), 10, 64)
+		if err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	s.cursor, err = os.OpenFile(filepath.Join(s.dir, spoolCursor), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var cursor [16]byte
+	var cursorSeq uint64
+	var cursorOffset int64
+	if n, _ := s.cursor.ReadAt(cursor[:], 0); n == len(cursor) {
+		cursorSeq = binary.BigEndian.Uint64(cursor[:8])
+		cursorOffset = int64(binary.BigEndian.Uint64(cursor[8:]))
+	}
+
+	next := cursorSeq + 1
+	for _, seq := range seqs {
+		path := s.segmentPath(seq)
+		if seq < cursorSeq {
+			os.Remove(path)
+			continue
+		}
+		until := int64(0)
+		if seq == cursorSeq {
+			until = cursorOffset
+		}
+		segment, resume, delivered, err := scanSegment(path, until)
+		if err != nil {
+			return err
+		}
+		segment.seq = seq
+		if len(s.segments) == 0 {
+			s.offset, s.delivered = resume, delivered
+		}
+		s.segments = append(s.segments, segment)
+		s.size += segment.size
+		s.appended += uint64(segment.records)
+		next = seq + 1
+	}
+	s.handled = uint64(s.delivered)
+	return s.rotate(next)
+}
+
+// scanSegment counts the entries of a segment, truncating it at the first invalid one,
+// which was being written when the process died. It also returns the offset of the first entry
+// starting at or after until, and how many entries precede it.
+func scanSegment(path string, until int64) (segment spoolSegment, resume int64, before int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return segment, 0, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	found := false
+	var header [spoolHeader]byte
+	var data []byte
+	for {
+		if !found && segment.size >= until {
+			resume, before, found = segment.size, segment.records, true
+		}
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		n := int(binary.BigEndian.Uint32(header[:4]))
+		if cap(data) < n {
+			data = make([]byte, n)
+		}
+		data = data[:n]
+		if _, err := io.ReadFull(r, data); err != nil || crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		segment.size += spoolHeader + int64(n)
+		segment.records++
+	}
+	if !found {
+		resume, before = segment.size, segment.records
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() > segment.size {
+		if err := os.Truncate(path, segment.size); err != nil {
+			return segment, 0, 0, err
+		}
+	}
+	return segment, resume, before, nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+// rotate starts a new segment, the lock being held
+func (s *Spool) rotate(seq uint64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.segments = append(s.segments, spoolSegment{seq: seq})
+	if len(s.segments) == 1 {
+		s.offset, s.delivered = 0, 0
+		s.saveCursor()
+	}
+	return nil
+}
+
+func (s *Spool) append(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	n := spoolHeader + int64(len(p))
+	last := &s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+n > s.options.SegmentSize {
+		if err := s.rotate(last.seq + 1); err != nil {
+			return err
+		}
+		last = &s.segments[len(s.segments)-1]
+	}
+
+	var header [spoolHeader]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(p))
+	s.record = append(append(s.record[:0], header[:]...), p...)
+	if _, err := s.file.Write(s.record); err != nil {
+		// drop the partial entry
+		s.file.Truncate(last.size)
+		return err
+	}
+
+	last.size += n
+	last.records++
+	s.size += n
+	s.appended++
+	s.evict()
+	s.changed.Broadcast()
+	return nil
+}
+
+// evict deletes the oldest segments until the spool is under MaxBytes, the lock being held
+func (s *Spool) evict() {
+	for s.size > s.options.MaxBytes && len(s.segments) > 1 {
+		s.drop(s.segments[0].records - s.delivered)
+		s.removeOldest()
+	}
+}
+
+// drop counts entries evicted or unreadable, the lock being held
+func (s *Spool) drop(n int) {
+	atomic.AddUint64(&s.dropped, uint64(n))
+	s.handled += uint64(n)
+}
+
+// removeOldest deletes the oldest segment, the replay moving to the next one, the lock being held
+func (s *Spool) removeOldest() {
+	oldest := s.segments[0]
+	os.Remove(s.segmentPath(oldest.seq))
+	s.size -= oldest.size
+	s.segments = s.segments[1:]
+	s.offset, s.delivered = 0, 0
+	s.saveCursor()
+}
+
+// saveCursor writes the position of the replay, the lock being held
+func (s *Spool) saveCursor() {
+	var cursor [16]byte
+	binary.BigEndian.PutUint64(cursor[:8], s.segments[0].seq)
+	binary.BigEndian.PutUint64(cursor[8:], uint64(s.offset))
+	if _, err := s.cursor.WriteAt(cursor[:], 0); err != nil {
+		s.error(err)
+	}
+}
+
+func (s *Spool) run() {
+	defer close(s.done)
+	defer func() {
+		if s.reader != nil {
+			s.reader.Close()
+		}
+	}()
+
+	for {
+		seq, offset, p, ok := s.next()
+		if !ok {
+			return
+		}
+		for {
+			s.outMu.Lock()
+			_, err := s.out.Write(p)
+			s.outMu.Unlock()
+			if err == nil {
+				break
+			}
+			s.error(err)
+
+			s.mu.Lock()
+			s.failures++
+			s.changed.Broadcast()
+			s.mu.Unlock()
+
+			select {
+			case <-time.After(s.options.RetryInterval):
+			case <-s.stop:
+				return
+			}
+
+			// the entry was counted as dropped when its segment was evicted meanwhile
+			if s.evicted(seq, offset) {
+				break
+			}
+		}
+		s.advance(seq, offset, len(p))
+	}
+}
+
+// next reads the oldest entry not delivered, waiting for one to be appended
+func (s *Spool) next() (seq uint64, offset int64, p []byte, ok bool) {
+	for {
+		s.mu.Lock()
+		for !s.closed && s.offset >= s.segments[0].size {
+			if len(s.segments) == 1 {
+				s.changed.Wait()
+				continue
+			}
+			// the oldest segment was delivered
+			s.removeOldest()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return 0, 0, nil, false
+		}
+		seq, offset = s.segments[0].seq, s.offset
+		s.mu.Unlock()
+
+		p, err := s.read(seq, offset)
+		if err == nil {
+			return seq, offset, p, true
+		}
+		s.error(fmt.Errorf("log: spool: %s: %v", s.segmentPath(seq), err))
+		s.skip(seq)
+	}
+}
+
+// read reads the entry at the offset of the segment
+func (s *Spool) read(seq uint64, offset int64) ([]byte, error) {
+	if s.reader == nil || s.readerSeq != seq {
+		if s.reader != nil {
+			s.reader.Close()
+			s.reader = nil
+		}
+		f, err := os.Open(s.segmentPath(seq))
+		if err != nil {
+			return nil, err
+		}
+		s.reader, s.readerSeq = f, seq
+	}
+
+	var header [spoolHeader]byte
+	if _, err := s.reader.ReadAt(header[:], offset); err != nil {
+		return nil, err
+	}
+	p := make([]byte, binary.BigEndian.Uint32(header[:4]))
+	if _, err := s.reader.ReadAt(p, offset+spoolHeader); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(p) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, fmt.Errorf("invalid checksum at offset %d", offset)
+	}
+	return p, nil
+}
+
+// evicted tells whether the replay moved past the entry, its segment being evicted
+func (s *Spool) evicted(seq uint64, offset int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.segments[0].seq != seq || s.offset != offset
+}
+
+// advance moves the replay past the delivered entry, unless its segment was evicted meanwhile
+func (s *Spool) advance(seq uint64, offset int64, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.segments[0].seq != seq || s.offset != offset {
+		return
+	}
+	s.offset += spoolHeader + int64(n)
+	s.delivered++
+	s.handled++
+	s.saveCursor()
+	s.changed.Broadcast()
+}
+
+// skip drops the rest of an unreadable segment
+func (s *Spool) skip(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldest := &s.segments[0]
+	if oldest.seq != seq {
+		return
+	}
+	s.drop(oldest.records - s.delivered)
+	if len(s.segments) > 1 {
+		s.removeOldest()
+	} else {
+		s.offset, s.delivered = oldest.size, oldest.records
+		s.saveCursor()
+	}
+	s.changed.Broadcast()
+}
+
+func (s *Spool) error(err error) {
+	if s.options.OnError != nil {
+		s.options.OnError(err)
+		return
+	}
+	s.stats.report(err)
+}
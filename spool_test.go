@@ -0,0 +1,216 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// sinkWriter records the documents written while it is up, failing otherwise
+type sinkWriter struct {
+	mu   sync.Mutex
+	up   bool
+	docs []string
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.up {
+		return 0, errors.New("sink down")
+	}
+	w.docs = append(w.docs, strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+func (w *sinkWriter) setUp(up bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.up = up
+}
+
+func (w *sinkWriter) received() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Join(w.docs, ",")
+}
+
+func openSpool(t *testing.T, dir string, sink *sinkWriter, options log.SpoolOptions) (*log.Spool, *log.Emitter) {
+	t.Helper()
+	options.RetryInterval = time.Millisecond
+	options.OnError = func(error) {}
+	out, err := log.OpenSpool(dir, sink, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, log.New(log.WithOutput(out), log.WithEncoder(&plainEncoder{}))
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &sinkWriter{}
+	out, e := openSpool(t, dir, sink, log.SpoolOptions{SegmentSize: 40})
+	defer out.Close()
+
+	// the entries are kept while the sink is down
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		e.I("test", msg)
+	}
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Pending() != 4 || sink.received() != "" {
+		t.Fatalf("invalid pending entries: %d, %q", out.Pending(), sink.received())
+	}
+
+	// and replayed in order once it recovers, the delivered segments being deleted
+	sink.setUp(true)
+	e.I("test", "five")
+	waitFor(t, "the replay", func() bool { return out.Pending() == 0 })
+	want := "test one,test two,test three,test four,test five"
+	if got := sink.received(); got != want {
+		t.Errorf("invalid documents:\nwant: %s\ngot: %s", want, got)
+	}
+	if files := listDir(t, dir); len(files) != 2 {
+		t.Errorf("delivered segments were kept: %v", files)
+	}
+}
+
+func TestSpoolResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &sinkWriter{up: true}
+	out, e := openSpool(t, dir, sink, log.SpoolOptions{})
+	e.I("test", "one")
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	sink.setUp(false)
+	e.I("test", "two")
+	e.I("test", "three")
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process died while writing an entry
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 42, 1, 2})
+	f.Close()
+
+	// the entries not delivered are replayed by the next one
+	sink = &sinkWriter{up: true}
+	out, e = openSpool(t, dir, sink, log.SpoolOptions{})
+	defer out.Close()
+	e.I("test", "four")
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	want := "test two,test three,test four"
+	if got := sink.received(); got != want {
+		t.Errorf("invalid documents:\nwant: %s\ngot: %s", want, got)
+	}
+}
+
+func TestSpoolEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &sinkWriter{}
+	out, e := openSpool(t, dir, sink, log.SpoolOptions{SegmentSize: 45, MaxBytes: 100})
+	defer out.Close()
+
+	// each entry takes 15 bytes, so segments hold three entries, and the spool at most six
+	for i := 0; i < 20; i++ {
+		e.I("test", string(rune('a'+i)))
+	}
+	if out.Dropped() == 0 || out.Pending()+int(out.Dropped()) != 20 {
+		t.Fatalf("invalid dropped entries: %d dropped, %d pending", out.Dropped(), out.Pending())
+	}
+
+	var size int64
+	files, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	for _, file := range files {
+		info, _ := os.Stat(file)
+		size += info.Size()
+	}
+	if size > 100 {
+		t.Errorf("the spool is too large: %d bytes", size)
+	}
+
+	// the newest entries are replayed
+	sink.setUp(true)
+	waitFor(t, "the replay", func() bool { return out.Pending() == 0 })
+	docs := strings.Split(sink.received(), ",")
+	if len(docs) != 20-int(out.Dropped()) || docs[0] == "test a" || docs[len(docs)-1] != "test t" {
+		t.Errorf("invalid documents: %v", docs)
+	}
+}
+
+func TestSpoolSyncWhileReplaying(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	out, err := log.OpenSpool(dir, bufio.NewWriter(&buf), log.SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := log.New(log.WithOutput(out))
+
+	done := make(chan struct{})
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				e.Sync()
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		e.I("test", "hello")
+	}
+	close(done)
+	<-synced
+
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 1000 {
+		t.Errorf("invalid line count: %d", got)
+	}
+}
@@ -0,0 +1,294 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SyslogFormat is the syslog protocol version
+type SyslogFormat byte
+
+const (
+	// RFC5424 is the current syslog protocol. This is the default.
+	RFC5424 SyslogFormat = iota
+
+	// RFC3164 is the legacy BSD syslog protocol
+	RFC3164
+)
+
+// Facility is the syslog facility, telling the kind of application logging
+type Facility int
+
+// Syslog facilities. FacilityKern is reserved to the kernel, so the zero value means FacilityUser.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// SyslogOptions configures NewSyslog. The zero value writes to the local syslog daemon.
+type SyslogOptions struct {
+	// Network is either udp, tcp, unix or unixgram, the local syslog socket being used when empty
+	Network string
+
+	// Address is the address of the syslog server, like localhost:514 or /dev/log
+	Address string
+
+	// Format is the syslog protocol version
+	Format SyslogFormat
+
+	// Facility is the syslog facility, FacilityUser when zero
+	Facility Facility
+
+	// AppName identifies the application, the executable name when empty
+	AppName string
+
+	// Hostname identifies the machine, os.Hostname when empty
+	Hostname string
+
+	// MaxSize truncates the messages longer than the given bytes,
+	// 2048 bytes for datagrams and 64 KiB for streams when zero
+	MaxSize int
+
+	// Timeout limits dialing and writing, five seconds when zero
+	Timeout time.Duration
+
+	// Encoder renders the entries as the syslog messages, the emitter encoder when nil
+	Encoder Encoder
+}
+
+// Syslog is an output sending the entries to a syslog server.
+//
+// Levels are sent with their syslog severity, see Level.Severity and RegisterLevel: Trace and Debug
+// as debug, Info as informational, Warn as warning, Error as error, and Panic and Fatal as critical.
+// The tag is sent as the RFC 5424 message ID, and the encoded entry as the message.
+//
+// Messages are sent as they are over datagrams, newline terminated over unix streams
+// and with octet counting framing over TCP, as described by RFC 6587.
+// The connection is dialed again when writing fails, at most once a second.
+type Syslog struct {
+	options SyslogOptions
+	pid     string
+
+	mu       sync.Mutex
+	conn     redialer
+	network  string
+	header   bytes.Buffer
+	document bytes.Buffer
+	frame    []byte
+}
+
+// NewSyslog connects to the syslog server
+func NewSyslog(options SyslogOptions) (*Syslog, error) {
+	if options.Facility == FacilityKern {
+		options.Facility = FacilityUser
+	}
+	if options.AppName == "" {
+		options.AppName = filepath.Base(os.Args[0])
+	}
+	if options.Hostname == "" {
+		options.Hostname, _ = os.Hostname()
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+
+	s := &Syslog{options: options, pid: strconv.Itoa(os.Getpid())}
+	s.conn = redialer{dial: s.dial, timeout: options.Timeout}
+	if err := s.conn.connect(); err != nil {
+		return nil, err
+	}
+	if s.options.MaxSize <= 0 {
+		s.options.MaxSize = 64 << 10
+		if s.datagram() {
+			s.options.MaxSize = 2048
+		}
+	}
+	return s, nil
+}
+
+// WriteEntry implements EntryWriter
+func (s *Syslog) WriteEntry(e *Emitter, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.document.Reset()
+	encoder := s.options.Encoder
+	if encoder == nil {
+		encoder = e.encoder()
+	}
+	encoder.Encode(&s.document, e, entry)
+	return s.send(entry.Time, entry.Tag, entry.Level, s.document.Bytes())
+}
+
+// Write implements io.Writer, sending the document as an untagged Info entry
+func (s *Syslog) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.send(time.Now(), "", Info, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Concurrent implements ConcurrentWriter, as the connection is locked
+func (s *Syslog) Concurrent() bool {
+	return true
+}
+
+// Close closes the connection
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// send formats and writes the message, dialing again once when writing fails
+func (s *Syslog) send(t time.Time, tag string, level Level, msg []byte) error {
+	msg = bytes.TrimRight(msg, "\n")
+	s.format(t, tag, level, msg)
+
+	// the framing depends on the network dialed
+	if err := s.conn.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(s.framed())
+	return err
+}
+
+// format renders the syslog message into the header buffer
+func (s *Syslog) format(t time.Time, tag string, level Level, msg []byte) {
+	b := &s.header
+	b.Reset()
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(int(s.options.Facility)*8 + level.Severity()))
+	b.WriteByte('>')
+
+	if s.options.Format == RFC3164 {
+		b.WriteString(t.Format(time.Stamp))
+		b.WriteByte(' ')
+		b.WriteString(headerField(s.options.Hostname, 255))
+		b.WriteByte(' ')
+		b.WriteString(headerField(s.options.AppName, 32))
+		b.WriteString("[" + s.pid + "]: ")
+	} else {
+		b.WriteString("1 ")
+		b.WriteString(t.Format("2006-01-02T15:04:05.000000Z07:00"))
+		b.WriteByte(' ')
+		b.WriteString(headerField(s.options.Hostname, 255))
+		b.WriteByte(' ')
+		b.WriteString(headerField(s.options.AppName, 48))
+		b.WriteByte(' ')
+		b.WriteString(s.pid)
+		b.WriteByte(' ')
+		b.WriteString(headerField(tag, 32))
+		b.WriteString(" - ")
+	}
+
+	if room := s.options.MaxSize - b.Len(); len(msg) > room {
+		msg = truncateUTF8(msg, room)
+	}
+	b.Write(msg)
+}
+
+// framed returns the formatted message with the framing of the network
+func (s *Syslog) framed() []byte {
+	msg := s.header.Bytes()
+	switch s.network {
+	case "tcp", "tcp4", "tcp6":
+		s.frame = strconv.AppendInt(s.frame[:0], int64(len(msg)), 10)
+		s.frame = append(append(s.frame, ' '), msg...)
+		return s.frame
+	case "unix":
+		return append(msg, '\n')
+	default:
+		return msg
+	}
+}
+
+func (s *Syslog) dial() (net.Conn, error) {
+	if s.options.Network != "" {
+		conn, err := net.DialTimeout(s.options.Network, s.options.Address, s.options.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		s.network = s.options.Network
+		return conn, nil
+	}
+
+	// the local daemon listens on a unix socket, either a datagram or a stream one
+	addresses := []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	if s.options.Address != "" {
+		addresses = []string{s.options.Address}
+	}
+	for _, address := range addresses {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, address, s.options.Timeout)
+			if err == nil {
+				s.network = network
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("log: syslog: no local syslog socket")
+}
+
+func (s *Syslog) datagram() bool {
+	return s.network == "udp" || s.network == "udp4" || s.network == "udp6" || s.network == "unixgram"
+}
+
+// headerField makes the value a valid header field, printable ASCII without spaces
+func headerField(value string, max int) string {
+	if value == "" {
+		return "-"
+	}
+	b := []byte(value)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// truncateUTF8 cuts the bytes to the given length, without splitting a character
+func truncateUTF8(b []byte, n int) []byte {
+	if n <= 0 {
+		return nil
+	}
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return b[:n]
+}
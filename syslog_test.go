@@ -0,0 +1,190 @@
+package log_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	const notice = log.Info + 5
+	if err := log.RegisterLevel(notice, "notice", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	out, err := log.NewSyslog(log.SyslogOptions{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: log.FacilityLocal3,
+		AppName:  "my app",
+		Hostname: "host",
+		MaxSize:  120,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out), log.WithLevel(log.Trace))
+
+	tests := []struct {
+		level log.Level
+		msg   string
+		want  string
+	}{
+		{log.Warn, "careful", `^<156>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) host my_app \d+ http - {"tag":"http","level":"warn","msg":"careful"}$`},
+		{log.Trace, "details", `^<159>1 .* http - {"tag":"http","level":"trace","msg":"details"}$`},
+		{log.Fatal, "halting", `^<154>1 .* http - {"tag":"http","level":"fatal","msg":"halting"}$`},
+		{notice, "noted", `^<157>1 .* http - {"tag":"http","level":"notice","msg":"noted"}$`},
+		{log.Info, strings.Repeat("é", 100), `^<158>1 .* http - {"tag":"http","level":"info","msg":"(é)+$`},
+	}
+
+	buf := make([]byte, 4096)
+	for _, test := range tests {
+		e.Emit("http", test.level, test.msg)
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); !regexp.MustCompile(test.want).MatchString(got) {
+			t.Errorf("invalid message:\nwant: %s\ngot: %s", test.want, got)
+		}
+		if n > 120 {
+			t.Errorf("message was not truncated: %d bytes", n)
+		}
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	out, err := log.NewSyslog(log.SyslogOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		Format:   log.RFC3164,
+		AppName:  "app",
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	e := log.New(log.WithOutput(out))
+
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(server)
+
+	e.E("db", "failure")
+	want := regexp.MustCompile(`^<11>\w{3} [ \d]\d \d\d:\d\d:\d\d host app\[\d+\]: {"tag":"db","level":"error","msg":"failure"}$`)
+	if got := readFrame(t, r); !want.MatchString(got) {
+		t.Errorf("invalid message: %s", got)
+	}
+
+	// the output dials again once the server drops the connection
+	server.Close()
+	done := make(chan string)
+	go func() {
+		server, err := ln.Accept()
+		if err != nil {
+			close(done)
+			return
+		}
+		defer server.Close()
+		done <- readFrame(t, bufio.NewReader(server))
+	}()
+
+	var got string
+	for got == "" {
+		e.I("db", "reconnected")
+		select {
+		case got = <-done:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if !strings.HasSuffix(got, `"msg":"reconnected"}`) {
+		t.Errorf("invalid message after reconnecting: %s", got)
+	}
+}
+
+// readFrame reads an octet counted syslog message
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Error(err)
+	}
+	return string(msg)
+}
+
+func TestSyslogUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "syslog.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	// the local socket is used when the network is empty
+	out, err := log.NewSyslog(log.SyslogOptions{Address: path, Hostname: "host", AppName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	e := log.New(log.WithOutput(out), log.WithEncoder(log.ConsoleEncoder{}))
+	e.I("", "hello", "a", 1)
+
+	line, err := bufio.NewReader(server).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := regexp.MustCompile(`^<14>1 \S+ host app \d+ - - INFO  \[\] hello a=1\n$`)
+	if !want.MatchString(line) {
+		t.Errorf("invalid message: %q", line)
+	}
+}
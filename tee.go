@@ -0,0 +1,262 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// TeeOutput is one of the outputs of a Tee
+type TeeOutput struct {
+	Output io.Writer
+
+	// Level is the minimum level written to the output
+	Level Level
+
+	// Encoder renders the entries for the output, the emitter encoder when nil
+	Encoder Encoder
+}
+
+// Tee is an output sending every entry to several outputs, each with its own level and encoder.
+//
+// The common use case is
+//
+//	log.Configure(log.WithOutput(log.NewTee(
+//		log.TeeOutput{Output: os.Stdout, Level: log.Info},
+//		log.TeeOutput{Output: file, Level: log.Trace, Encoder: log.ConsoleEncoder{}},
+//		log.TeeOutput{Output: alerts, Level: log.Error},
+//	)))
+//
+// Each entry is encoded once per distinct encoder. Outputs are written in order,
+// and a failing or panicking output does not prevent the others from being written.
+//
+// Outputs are written by the logging goroutine, so an output that blocks delays the outputs
+// after it and the logging call itself. Outputs that may block, like pipes and network outputs,
+// must be wrapped with NewAsyncOutput or be asynchronous themselves, like HTTPOutput.
+type Tee struct {
+	outputSet
+}
+
+// NewTee returns a tee writing to the given outputs
+func NewTee(outputs ...TeeOutput) *Tee {
+	return &Tee{newOutputSet(outputs)}
+}
+
+// WriteEntry implements EntryWriter
+func (t *Tee) WriteEntry(e *Emitter, entry *Entry) error {
+	return t.writeEntry(e, entry, func(i int) bool { return entry.Level >= t.outputs[i].Level })
+}
+
+// outputSet writes entries to several outputs, encoding them once per distinct encoder
+type outputSet struct {
+	outputs []TeeOutput
+
+	// slots maps every output to the index of the first output sharing its encoder
+	slots []int
+}
+
+func newOutputSet(outputs []TeeOutput) outputSet {
+	set := outputSet{outputs: make([]TeeOutput, len(outputs)), slots: make([]int, len(outputs))}
+	// outputs listed twice share their lock, the others cannot be told apart
+	for i, out := range outputs {
+		locked := Locked(out.Output)
+		if out.Output != nil && reflect.TypeOf(out.Output).Comparable() {
+			for j := 0; j < i; j++ {
+				if outputs[j].Output == out.Output {
+					locked = set.outputs[j].Output
+					break
+				}
+			}
+		}
+		out.Output = locked
+		set.outputs[i] = out
+	}
+	for i, out := range outputs {
+		set.slots[i] = i
+		for j := 0; j < i; j++ {
+			if sameEncoder(out.Encoder, outputs[j].Encoder) {
+				set.slots[i] = j
+				break
+			}
+		}
+	}
+	return set
+}
+
+func sameEncoder(a, b Encoder) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Concurrent implements ConcurrentWriter, as the outputs are locked
+func (t *outputSet) Concurrent() bool {
+	return true
+}
+
+// writeEntry writes the entry to the selected outputs
+func (t *outputSet) writeEntry(e *Emitter, entry *Entry, selected func(i int) bool) error {
+	// encoded documents indexed by slot
+	var bufs [8]*bytes.Buffer
+	encoded := bufs[:]
+	if len(t.outputs) > len(bufs) {
+		encoded = make([]*bytes.Buffer, len(t.outputs))
+	}
+
+	var errs []error
+	written := 0
+	for i, out := range t.outputs {
+		if !selected(i) || t.written(i, selected) {
+			continue
+		}
+		written++
+		if w, ok := out.Output.(EntryWriter); ok {
+			teeEntry(w, e, entry, out.Encoder, &errs)
+			continue
+		}
+
+		slot := t.slots[i]
+		if encoded[slot] == nil {
+			encoded[slot] = pool.Get().(*bytes.Buffer)
+			encoder := out.Encoder
+			if encoder == nil {
+				encoder = e.encoder()
+			}
+			encoder.Encode(encoded[slot], e, entry)
+		}
+		teeWrite(out.Output, encoded[slot].Bytes(), &errs)
+	}
+
+	for _, buf := range encoded {
+		if buf != nil {
+			buf.Reset()
+			pool.Put(buf)
+		}
+	}
+
+	return partialError(teeError(errs, len(t.outputs)), len(errs), written)
+}
+
+// Write implements io.Writer, sending the encoded entry to every output regardless of its level
+func (t *Tee) Write(p []byte) (int, error) {
+	return t.write(p)
+}
+
+func (t *outputSet) write(p []byte) (int, error) {
+	var errs []error
+	for _, out := range t.outputs {
+		teeWrite(out.Output, p, &errs)
+	}
+	return len(p), partialError(teeError(errs, len(t.outputs)), len(errs), len(t.outputs))
+}
+
+// Sync flushes every output, see Emitter.Sync
+func (t *outputSet) Sync() error {
+	var errs []error
+	for i, out := range t.outputs {
+		if t.repeated(i) {
+			continue
+		}
+		if err := syncValue(out.Output); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return teeError(errs, len(t.outputs))
+}
+
+// Close closes every output but the standard output and error, see Emitter.Close
+func (t *outputSet) Close() error {
+	var errs []error
+	for i, out := range t.outputs {
+		if t.repeated(i) || isStdStream(out.Output) {
+			continue
+		}
+		if err := closeValue(out.Output); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return teeError(errs, len(t.outputs))
+}
+
+// repeated tells whether the output was already listed, so it is not flushed nor closed twice
+func (t *outputSet) repeated(i int) bool {
+	return t.written(i, func(int) bool { return true })
+}
+
+// written tells whether the output was already selected, so an entry is written to it only once
+func (t *outputSet) written(i int, selected func(i int) bool) bool {
+	w := t.outputs[i].Output
+	if w == nil || !reflect.TypeOf(w).Comparable() {
+		return false
+	}
+	for j := 0; j < i; j++ {
+		if t.outputs[j].Output == w && selected(j) {
+			return true
+		}
+	}
+	return false
+}
+
+func teeEntry(w EntryWriter, e *Emitter, entry *Entry, encoder Encoder, errs *[]error) {
+	defer func() {
+		if r := recover(); r != nil {
+			*errs = append(*errs, fmt.Errorf("log: output panic: %v", r))
+		}
+	}()
+	if encoder != nil {
+		// the output encoder takes over the emitter one
+		copied := *e
+		copied.Encoder = encoder
+		e = &copied
+	}
+	if err := w.WriteEntry(e, entry); err != nil {
+		*errs = append(*errs, err)
+	}
+}
+
+func teeWrite(w io.Writer, p []byte, errs *[]error) {
+	defer func() {
+		if r := recover(); r != nil {
+			*errs = append(*errs, fmt.Errorf("log: output panic: %v", r))
+		}
+	}()
+	if _, err := w.Write(p); err != nil {
+		*errs = append(*errs, err)
+	}
+}
+
+// partialWriteError reports outputs failing to write an entry the other outputs wrote
+type partialWriteError struct {
+	err error
+}
+
+func (p *partialWriteError) Error() string {
+	return p.err.Error()
+}
+
+func (p *partialWriteError) Unwrap() error {
+	return p.err
+}
+
+// partialError marks the error as partial when some of the outputs written did not fail
+func partialError(err error, failed, written int) error {
+	if err == nil || failed >= written {
+		return err
+	}
+	return &partialWriteError{err: err}
+}
+
+func teeError(errs []error, outputs int) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("log: %d of %d outputs failed, first: %v", len(errs), outputs, errs[0])
+}
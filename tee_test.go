@@ -0,0 +1,146 @@
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// countingEncoder counts how many times entries are encoded
+type countingEncoder struct {
+	log.Encoder
+	count *int
+}
+
+func (c countingEncoder) Encode(buf *bytes.Buffer, e *log.Emitter, entry *log.Entry) {
+	*c.count++
+	c.Encoder.Encode(buf, e, entry)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("broken pipe") }
+
+type panickingWriter struct{}
+
+func (panickingWriter) Write(p []byte) (int, error) { panic("broken writer") }
+
+func TestTee(t *testing.T) {
+	stdout, file, alerts := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	count := 0
+	json := &countingEncoder{Encoder: log.JSONEncoder{}, count: &count}
+
+	tee := log.NewTee(
+		log.TeeOutput{Output: stdout, Level: log.Info, Encoder: json},
+		log.TeeOutput{Output: failingWriter{}, Level: log.Trace},
+		log.TeeOutput{Output: panickingWriter{}, Level: log.Trace},
+		log.TeeOutput{Output: file, Level: log.Trace, Encoder: log.ConsoleEncoder{}},
+		log.TeeOutput{Output: alerts, Level: log.Error, Encoder: json},
+	)
+	var errs []error
+	e := log.New(log.WithOutput(tee), log.WithLevel(log.Trace),
+		log.WithWriteErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	e.T("TAG", "tracing")
+	e.I("TAG", "starting", "a", 1)
+	e.E("TAG", "failing")
+
+	if len(errs) != 3 || errs[0].Error() != "log: 2 of 5 outputs failed, first: broken pipe" {
+		t.Errorf("invalid errors: %v", errs)
+	}
+
+	want := `{"tag":"TAG","level":"info","msg":"starting","a":1}` + "\n" +
+		`{"tag":"TAG","level":"error","msg":"failing"}` + "\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("invalid stdout:\nwant: %s\ngot: %s", want, got)
+	}
+
+	want = "TRACE [TAG] tracing\nINFO  [TAG] starting a=1\nERROR [TAG] failing\n"
+	if got := file.String(); got != want {
+		t.Errorf("invalid file:\nwant: %s\ngot: %s", want, got)
+	}
+
+	want = `{"tag":"TAG","level":"error","msg":"failing"}` + "\n"
+	if got := alerts.String(); got != want {
+		t.Errorf("invalid alerts:\nwant: %s\ngot: %s", want, got)
+	}
+
+	// the error entry is encoded once for stdout and alerts
+	if count != 2 {
+		t.Errorf("invalid encoding count:\nwant: 2\ngot: %d", count)
+	}
+
+	entry := &log.Entry{Tag: "TAG", Level: log.Info}
+	err := tee.WriteEntry(e, entry)
+	if err == nil || !strings.Contains(err.Error(), "2 of 5 outputs failed, first: broken pipe") {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+// blockingWriter blocks every write until released
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (b blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	return len(p), nil
+}
+
+func TestTeeBlockingOutput(t *testing.T) {
+	blocked := blockingWriter{release: make(chan struct{})}
+	async := log.NewAsyncOutput(blocked, log.AsyncOutputOptions{Size: 4, FlushInterval: time.Millisecond, Overflow: log.OverflowDropNewest})
+	fast := &syncBuffer{}
+
+	e := log.New(log.WithOutput(log.NewTee(
+		log.TeeOutput{Output: async},
+		log.TeeOutput{Output: fast},
+	)))
+
+	// the asynchronous output keeps the blocked one from stalling the tee
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			e.I("TAG", "entry")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the blocked output stalled the tee")
+	}
+	if got := strings.Count(fast.String(), "entry"); got != 10 {
+		t.Errorf("invalid entries written: %d", got)
+	}
+
+	close(blocked.release)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// funcWriter is a writer of a type which cannot be compared
+type funcWriter func(p []byte)
+
+func (f funcWriter) Write(p []byte) (int, error) {
+	f(p)
+	return len(p), nil
+}
+
+func TestTeeNonComparable(t *testing.T) {
+	var first, second bytes.Buffer
+	e := log.New(log.WithOutput(log.NewTee(
+		log.TeeOutput{Output: funcWriter(func(p []byte) { first.Write(p) })},
+		log.TeeOutput{Output: funcWriter(func(p []byte) { second.Write(p) })},
+	)))
+	e.I("TAG", "entry")
+
+	if first.String() != second.String() || !strings.Contains(first.String(), `"msg":"entry"`) {
+		t.Errorf("invalid outputs: %q %q", first.String(), second.String())
+	}
+}
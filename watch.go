@@ -0,0 +1,240 @@
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads a configuration file into an emitter, see Watch
+type Watcher struct {
+	emitter *Emitter
+	path    string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// Watch applies the configuration file to the Default emitter, and then reloads it
+// whenever the file changes or the process receives a SIGHUP.
+//
+// Every reload is applied atomically to Default and to all the contexts derived from it.
+// Only the level, tags, redact and drop settings are reloaded, the others need a restart.
+// Invalid configurations are logged and rejected, keeping the current settings.
+//
+// The file is polled every interval, which suits files mounted from Kubernetes ConfigMaps.
+func Watch(path string, interval time.Duration) (*Watcher, error) {
+	return Default.Watch(path, interval)
+}
+
+// Watch applies the configuration file to the emitter, and then reloads it into the emitter
+// and all the contexts derived from it. See the package level Watch.
+func (e *Emitter) Watch(path string, interval time.Duration) (*Watcher, error) {
+	w := &Watcher{emitter: e, path: path, stop: make(chan struct{})}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("log: watching config: %v", err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	// the reloadable settings are only stored as rules, so the emitter keeps its own
+	// as the fallback of the settings missing from later versions of the file
+	static := *c
+	static.Level, static.Tags, static.Redact, static.Drop = "", nil, nil, ""
+	if err := e.apply(&static); err != nil {
+		return nil, err
+	}
+	e.storeRules(c.rules())
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	go w.run(interval)
+	return w, nil
+}
+
+// Reload reads the configuration file again and applies it when it is valid
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if info, err := os.Stat(w.path); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		w.emitter.E("log", "invalid configuration, keeping the current one", "path", w.path, "err", err)
+		return err
+	}
+	c, err := parseConfig(data)
+	if err != nil {
+		w.emitter.E("log", "invalid configuration, keeping the current one", "path", w.path, "err", err)
+		return err
+	}
+
+	next := c.rules()
+	changes := w.emitter.diffRules(next)
+	w.emitter.storeRules(next)
+	if len(changes) > 0 {
+		w.emitter.I("log", "configuration reloaded", "path", w.path, "changes", strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// Stop stops watching the file, keeping the last configuration applied
+func (w *Watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+func (w *Watcher) run(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-hup:
+			w.Reload()
+		case <-ticker.C:
+			if w.changed() {
+				w.Reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		// a ConfigMap update swaps the file, it shows up again on the next tick
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// rules returns the reloadable settings of the configuration, which must be valid
+func (c *Config) rules() *rules {
+	r := &rules{}
+	if c.Level != "" {
+		r.level, _ = ParseLevel(c.Level)
+		r.hasLevel = true
+	}
+	if c.Tags != nil {
+		r.tags = make(map[string]Level, len(c.Tags))
+		for tag, name := range c.Tags {
+			r.tags[tag], _ = ParseLevel(name)
+		}
+	}
+	if c.Redact != nil {
+		r.redact = make(map[string]bool, len(c.Redact))
+		for _, key := range c.Redact {
+			r.redact[key] = true
+		}
+	}
+	if c.Drop != "" {
+		r.drop, _ = CompileFilter(c.Drop)
+	}
+	r.hasDrop = c.Drop != "" || c.hasDrop
+	return r
+}
+
+// diffRules describes what changes when the rules replace the current ones
+func (e *Emitter) diffRules(next *rules) []string {
+	var changes []string
+
+	prevLevel, nextLevel := e.Level, e.Level
+	prevTags, nextTags := e.TagLevels, e.TagLevels
+	prevRedact, nextRedact := e.redact, e.redact
+	if prev := e.loadRules(); prev != nil {
+		if prev.hasLevel {
+			prevLevel = prev.level
+		}
+		if prev.tags != nil {
+			prevTags = prev.tags
+		}
+		if prev.redact != nil {
+			prevRedact = prev.redact
+		}
+	}
+	if next.hasLevel {
+		nextLevel = next.level
+	}
+	if next.tags != nil {
+		nextTags = next.tags
+	}
+	if next.redact != nil {
+		nextRedact = next.redact
+	}
+
+	if prevLevel != nextLevel {
+		changes = append(changes, "level: "+prevLevel.String()+" -> "+nextLevel.String())
+	}
+
+	tags := make([]string, 0, len(prevTags)+len(nextTags))
+	for tag := range prevTags {
+		tags = append(tags, tag)
+	}
+	for tag := range nextTags {
+		if _, ok := prevTags[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		prev, hadPrev := prevTags[tag]
+		next, hasNext := nextTags[tag]
+		switch {
+		case !hadPrev:
+			changes = append(changes, "tags."+tag+": none -> "+next.String())
+		case !hasNext:
+			changes = append(changes, "tags."+tag+": "+prev.String()+" -> none")
+		case prev != next:
+			changes = append(changes, "tags."+tag+": "+prev.String()+" -> "+next.String())
+		}
+	}
+
+	if !reflect.DeepEqual(sortedKeys(prevRedact), sortedKeys(nextRedact)) {
+		changes = append(changes, fmt.Sprintf("redact: %v -> %v", sortedKeys(prevRedact), sortedKeys(nextRedact)))
+	}
+
+	if prevDrop, nextDrop := filterString(e.dropFilter()), filterString(next.drop); prevDrop != nextDrop {
+		changes = append(changes, fmt.Sprintf("drop: %q -> %q", prevDrop, nextDrop))
+	}
+	return changes
+}
+
+func filterString(f *Filter) string {
+	if f == nil {
+		return ""
+	}
+	return f.String()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,201 @@
+package log_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bemobi/log"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	write := func(config string) {
+		// a temporary file renamed over the config, like a ConfigMap update
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"level":"info","tags":{"db":"warn"}}`)
+
+	sink := &syncBuffer{}
+	e := log.New(log.WithOutput(sink))
+	w, err := e.Watch(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+
+	// derived before the reload, still follows it
+	logger := &log.Context{Emitter: e, Tag: "db"}
+	logger = logger.C("password", "secret")
+
+	if logger.Emitter.Enabled("db", log.Info) {
+		t.Fatal("db tag should start at warn")
+	}
+
+	write(`{"level":"debug","tags":{"http":"error"},"redact":["password"]}`)
+	waitFor(t, "reload", func() bool { return logger.Emitter.Enabled("db", log.Debug) })
+
+	if want := `"msg":"configuration reloaded"`; !strings.Contains(sink.String(), want) {
+		t.Errorf("reload was not logged: %s", sink.String())
+	}
+	for _, change := range []string{"level: info -> debug", "tags.db: warn -> none", "tags.http: none -> error", "redact: [] -> [password]"} {
+		if !strings.Contains(sink.String(), change) {
+			t.Errorf("change %q was not logged: %s", change, sink.String())
+		}
+	}
+	if e.Enabled("http", log.Warn) {
+		t.Error("http tag should be at error")
+	}
+
+	logger.D("query", "token", "abc")
+	if want := `"msg":"query","password":"[REDACTED]","token":"abc"`; !strings.Contains(sink.String(), want) {
+		t.Errorf("password was not redacted: %s", sink.String())
+	}
+
+	write(`{"level":"loud"}`)
+	waitFor(t, "rejection", func() bool { return strings.Contains(sink.String(), "invalid configuration") })
+	if !e.Enabled("db", log.Debug) {
+		t.Error("invalid configuration disturbed the current one")
+	}
+
+	if err := w.Reload(); err == nil {
+		t.Error("invalid configuration was reloaded")
+	}
+}
+
+func TestWatchInvalid(t *testing.T) {
+	if _, err := log.New().Watch(filepath.Join(os.TempDir(), "missing-log-config.json"), time.Second); err == nil {
+		t.Error("watching a missing file should fail")
+	}
+}
+
+func TestWatchFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	if err := ioutil.WriteFile(path, []byte(`{"level":"debug","tags":{"db":"trace"},"redact":["password"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// not created by New, the context is derived before watching
+	sink := &syncBuffer{}
+	e := &log.Emitter{Level: log.Warn, Output: sink, TagLevels: map[string]log.Level{"db": log.Error}}
+	logger := (&log.Context{Emitter: e, Tag: "app"}).C("password", "secret")
+
+	w, err := e.Watch(path, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+
+	if !logger.Emitter.Enabled("app", log.Debug) || !logger.Emitter.Enabled("db", log.Trace) {
+		t.Error("the context does not follow the configuration")
+	}
+	if e.Level != log.Warn || e.TagLevels["db"] != log.Error {
+		t.Errorf("the emitter settings were overwritten: %v %v", e.Level, e.TagLevels)
+	}
+	logger.W("first")
+
+	if err := ioutil.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if logger.Emitter.Enabled("app", log.Info) || logger.Emitter.Enabled("db", log.Warn) {
+		t.Error("the settings missing from the file should fall back to the emitter ones")
+	}
+	logger.W("second")
+
+	want := `{"tag":"app","level":"warn","msg":"first","password":"[REDACTED]"}` + "\n" +
+		`{"tag":"app","level":"warn","msg":"second","password":"secret"}` + "\n"
+	if got := sink.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("\nwant: %s\ngot: %s", want, got)
+	}
+}
+
+func TestWatchDrop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	if err := ioutil.WriteFile(path, []byte(`{"level":"info"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &syncBuffer{}
+	e := log.New(log.WithOutput(sink), log.WithDrop(log.MustCompileFilter(`msg == "ping"`)))
+	w, err := e.Watch(path, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+
+	// without the drop key, the emitter filter applies
+	e.I("app", "ping")
+
+	if err := ioutil.WriteFile(path, []byte(`{"level":"info","drop":""}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	e.I("app", "ping")
+
+	if got := strings.Count(sink.String(), `"msg":"ping"`); got != 1 {
+		t.Errorf("invalid entries: %s", sink.String())
+	}
+}